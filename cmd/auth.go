@@ -0,0 +1,138 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/asteris-llc/vaultfs/fs"
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// addAuthFlags adds the flags selecting and configuring an auth method
+func addAuthFlags(flags *pflag.FlagSet) {
+	flags.String("auth-method", "token", "how to authenticate to vault (one of token, approle, cert, or kubernetes)")
+	flags.String("auth-mount", "", "path the auth method is mounted at (defaults to the method name)")
+	flags.String("jwt-file", fs.DefaultJWTFile, "file holding the service account token for kubernetes auth")
+	flags.String("role", "", "role to log in as for cert or kubernetes auth")
+	flags.String("role-id", "", "role ID for approle auth")
+	flags.String("secret-id-file", "", "file holding the secret ID for approle auth")
+	flags.String("token-file", "", "file holding the vault token, reloaded when it changes")
+	flags.String("wrapped-creation-path", "auth/token/create", "path the wrapped token must have been created at")
+	flags.String("wrapped-token", "", "response-wrapping token to unwrap for the vault token")
+	flags.String("wrapped-token-file", "", "file holding a response-wrapping token to unwrap for the vault token")
+}
+
+// tokenSource returns the token to use, or else the file to read it from. The
+// token is unwrapped from --wrapped-token or --wrapped-token-file, or else
+// taken from --token, --token-file, VAULT_TOKEN or ~/.vault-token, in that
+// order.
+func tokenSource(config *api.Config) (token, file string, err error) {
+	if wrapping := viper.GetString("wrapped-token"); wrapping != "" {
+		token, err := fs.Unwrap(config, wrapping, viper.GetString("wrapped-creation-path"))
+		return token, "", err
+	}
+
+	if file := viper.GetString("wrapped-token-file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", "", err
+		}
+
+		token, err := fs.Unwrap(config, strings.TrimSpace(string(content)), viper.GetString("wrapped-creation-path"))
+		return token, "", err
+	}
+
+	if token := viper.GetString("token"); token != "" {
+		return token, "", nil
+	}
+
+	if file := viper.GetString("token-file"); file != "" {
+		return "", file, nil
+	}
+
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, "", nil
+	}
+
+	if home := os.Getenv("HOME"); home != "" {
+		file := filepath.Join(home, ".vault-token")
+		if _, err := os.Stat(file); err == nil {
+			return "", file, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// authenticator returns the authenticator for the configured auth method, or
+// nil to use the static token
+func authenticator() (fs.Authenticator, error) {
+	switch viper.GetString("auth-method") {
+	case "token":
+		set := 0
+		for _, flag := range []string{"token", "token-file", "wrapped-token", "wrapped-token-file"} {
+			if viper.GetString(flag) != "" {
+				set++
+			}
+		}
+
+		if set > 1 {
+			return nil, errors.New("only one of --token, --token-file, --wrapped-token, and --wrapped-token-file may be set")
+		}
+		return nil, nil
+
+	case "approle":
+		if viper.GetString("role-id") == "" || viper.GetString("secret-id-file") == "" {
+			return nil, errors.New("approle auth needs --role-id and --secret-id-file")
+		}
+
+		return &fs.AppRole{
+			Mount:        viper.GetString("auth-mount"),
+			RoleID:       viper.GetString("role-id"),
+			SecretIDFile: viper.GetString("secret-id-file"),
+		}, nil
+
+	case "cert":
+		if viper.GetString("client-cert") == "" || viper.GetString("client-key") == "" {
+			return nil, errors.New("cert auth needs --client-cert and --client-key")
+		}
+
+		return &fs.Cert{
+			Mount: viper.GetString("auth-mount"),
+			Role:  viper.GetString("role"),
+		}, nil
+
+	case "kubernetes":
+		if viper.GetString("role") == "" {
+			return nil, errors.New("kubernetes auth needs --role")
+		}
+
+		return &fs.Kubernetes{
+			Mount:   viper.GetString("auth-mount"),
+			Role:    viper.GetString("role"),
+			JWTFile: viper.GetString("jwt-file"),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid auth method %q, expected one of token, approle, cert, or kubernetes", viper.GetString("auth-method"))
+}
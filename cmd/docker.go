@@ -16,6 +16,8 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/asteris-llc/vaultfs/docker"
@@ -38,14 +40,53 @@ var dockerCmd = &cobra.Command{
 			logrus.WithError(err).Fatal("could not bind flags")
 		}
 
+		if _, err := fs.ParseFormat(viper.GetString("format")); err != nil {
+			return err
+		}
+
+		if _, err := authenticator(); err != nil {
+			return err
+		}
+
+		switch viper.GetString("scope") {
+		case docker.ScopeLocal, docker.ScopeGlobal:
+		default:
+			return fmt.Errorf("invalid scope %q, expected one of local or global", viper.GetString("scope"))
+		}
+
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		driver := docker.New(docker.Config{
-			Root:  args[0],
-			Token: viper.GetString("token"),
-			Vault: fs.NewConfig(viper.GetString("address"), viper.GetBool("insecure")),
+		auth, err := authenticator()
+		if err != nil {
+			logrus.WithError(err).Fatal("invalid auth method")
+		}
+
+		config, err := vaultConfig()
+		if err != nil {
+			logrus.WithError(err).Fatal("error configuring TLS")
+		}
+
+		token, file, err := tokenSource(config)
+		if err != nil {
+			logrus.WithError(err).Fatal("error unwrapping token")
+		}
+
+		driver, err := docker.New(docker.Config{
+			Root:      args[0],
+			Token:     token,
+			TokenFile: file,
+			Vault:     config,
+
+			Format:   fs.Format(viper.GetString("format")),
+			CacheTTL: viper.GetDuration("cache-ttl"),
+			Timeout:  viper.GetDuration("timeout"),
+			Auth:     auth,
+			Scope:    viper.GetString("scope"),
 		})
+		if err != nil {
+			logrus.WithError(err).Fatal("error loading volumes")
+		}
 
 		logrus.WithFields(logrus.Fields{
 			"root":     args[0],
@@ -62,7 +103,7 @@ var dockerCmd = &cobra.Command{
 
 		handler := volume.NewHandler(driver)
 		logrus.WithField("socket", viper.GetString("socket")).Info("serving unix socket")
-		err := handler.ServeUnix("root", viper.GetString("socket"))
+		err = handler.ServeUnix(viper.GetString("socket"), 0)
 		if err != nil {
 			logrus.WithError(err).Fatal("failed serving")
 		}
@@ -73,7 +114,13 @@ func init() {
 	RootCmd.AddCommand(dockerCmd)
 
 	dockerCmd.Flags().StringP("address", "a", "https://localhost:8200", "vault address")
+	dockerCmd.Flags().Duration("cache-ttl", 0, "longest time to reuse responses from Vault (0 disables caching)")
+	dockerCmd.Flags().StringP("format", "f", "secret", "default format of secret files (one of secret, json, yaml, env, properties, or raw)")
 	dockerCmd.Flags().BoolP("insecure", "i", false, "skip SSL certificate verification")
 	dockerCmd.Flags().StringP("token", "t", "", "vault token")
+	dockerCmd.Flags().Duration("timeout", 30*time.Second, "longest time to wait for each request to Vault (0 waits forever)")
+	dockerCmd.Flags().String("scope", docker.ScopeLocal, "scope of volumes reported to docker (one of local or global)")
 	dockerCmd.Flags().StringP("socket", "s", "/run/docker/plugins/vault.sock", "socket address to communicate with docker")
+	addAuthFlags(dockerCmd.Flags())
+	addTLSFlags(dockerCmd.Flags())
 }
@@ -16,9 +16,11 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/asteris-llc/vaultfs/fs"
@@ -39,14 +41,74 @@ var mountCmd = &cobra.Command{
 			logrus.WithError(err).Fatal("could not bind flags")
 		}
 
+		switch fs.Layout(viper.GetString("layout")) {
+		case fs.LayoutSecret, fs.LayoutFields:
+		default:
+			return fmt.Errorf("invalid layout %q, expected one of secret or fields", viper.GetString("layout"))
+		}
+
+		if _, err := fs.ParseFormat(viper.GetString("format")); err != nil {
+			return err
+		}
+
+		switch viper.GetInt("kv-version") {
+		case 0, 1, 2:
+		default:
+			return fmt.Errorf("invalid key/value version %d, expected one of 0, 1, or 2", viper.GetInt("kv-version"))
+		}
+
+		if _, err := authenticator(); err != nil {
+			return err
+		}
+
+		switch fs.WriteMode(viper.GetString("write-mode")) {
+		case fs.WriteNone, fs.WriteJSON, fs.WriteValue:
+		default:
+			return fmt.Errorf("invalid write mode %q, expected one of none, json, or value", viper.GetString("write-mode"))
+		}
+
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		config := fs.NewConfig(viper.GetString("address"), viper.GetBool("insecure"))
+		config, err := vaultConfig()
+		if err != nil {
+			logrus.WithError(err).Fatal("error configuring TLS")
+		}
 
 		logrus.WithField("address", viper.GetString("address")).Info("creating FUSE client for Vault")
 
-		fs, err := fs.New(config, args[0], viper.GetString("token"), viper.GetString("root"))
+		opts := fs.Options{
+			Layout: fs.Layout(viper.GetString("layout")),
+			Format: fs.Format(viper.GetString("format")),
+			Write:  fs.WriteMode(viper.GetString("write-mode")),
+
+			AllowDelete: viper.GetBool("allow-delete"),
+			CacheTTL:    viper.GetDuration("cache-ttl"),
+			Timeout:     viper.GetDuration("timeout"),
+			KVVersion:   viper.GetInt("kv-version"),
+		}
+
+		auth, err := authenticator()
+		if err != nil {
+			logrus.WithError(err).Fatal("invalid auth method")
+		}
+		opts.Auth = auth
+
+		token, file, err := tokenSource(config)
+		if err != nil {
+			logrus.WithError(err).Fatal("error unwrapping token")
+		}
+		opts.TokenFile = file
+
+		if dir := viper.GetString("templates"); dir != "" {
+			templates, err := fs.ParseTemplates(dir)
+			if err != nil {
+				logrus.WithError(err).WithField("templates", dir).Fatal("error parsing templates")
+			}
+			opts.Templates = templates
+		}
+
+		fs, err := fs.New(config, args[0], token, viper.GetString("root"), opts)
 		if err != nil {
 			logrus.WithError(err).Fatal("error creatinging fs")
 		}
@@ -78,4 +140,14 @@ func init() {
 	mountCmd.Flags().StringP("address", "a", "https://localhost:8200", "vault address")
 	mountCmd.Flags().BoolP("insecure", "i", false, "skip SSL certificate verification")
 	mountCmd.Flags().StringP("token", "t", "", "vault token")
+	mountCmd.Flags().StringP("format", "f", "secret", "format of secret files (one of secret, json, yaml, env, properties, or raw)")
+	mountCmd.Flags().Int("kv-version", 0, "version of the key/value secrets engine (1 or 2, 0 detects it)")
+	mountCmd.Flags().StringP("layout", "l", "secret", "how to show secrets (one of secret or fields)")
+	mountCmd.Flags().Duration("cache-ttl", 0, "longest time to reuse responses from Vault (0 disables caching)")
+	mountCmd.Flags().Bool("allow-delete", false, "allow deleting secrets with unlink and rmdir")
+	mountCmd.Flags().Duration("timeout", 30*time.Second, "longest time to wait for each request to Vault (0 waits forever)")
+	mountCmd.Flags().String("templates", "", "directory of templates to render in _templates")
+	addAuthFlags(mountCmd.Flags())
+	addTLSFlags(mountCmd.Flags())
+	mountCmd.Flags().StringP("write-mode", "w", "none", "how to store written secrets (one of none, json, or value)")
 }
@@ -66,6 +66,12 @@ func initConfig() {
 	viper.AddConfigPath("$HOME")          // home directory as another path
 	viper.AutomaticEnv()                  // read in environment variables that match
 
+	// the address can come from the same variable as for the vault CLI,
+	// which is how it is set for the managed Docker plugin
+	if err := viper.BindEnv("address", "VAULT_ADDR"); err != nil {
+		logrus.WithError(err).Fatal("could not bind environment")
+	}
+
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		logrus.WithField("config", viper.ConfigFileUsed()).Info("using config file from disk")
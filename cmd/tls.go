@@ -0,0 +1,50 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/asteris-llc/vaultfs/fs"
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// addTLSFlags adds the flags configuring the connection to Vault
+func addTLSFlags(flags *pflag.FlagSet) {
+	flags.String("ca-cert", "", "PEM file of CA certificates to verify vault with")
+	flags.String("ca-path", "", "directory of PEM files of CA certificates to verify vault with")
+	flags.String("client-cert", "", "PEM client certificate to present to vault")
+	flags.String("client-key", "", "PEM private key for the client certificate")
+	flags.String("tls-server-name", "", "name to verify the certificate of vault for")
+}
+
+// vaultConfig returns the config for connecting to Vault
+func vaultConfig() (*api.Config, error) {
+	config, err := fs.NewConfig(viper.GetString("address"), fs.TLSOptions{
+		Insecure:   viper.GetBool("insecure"),
+		CACert:     viper.GetString("ca-cert"),
+		CAPath:     viper.GetString("ca-path"),
+		ClientCert: viper.GetString("client-cert"),
+		ClientKey:  viper.GetString("client-key"),
+		ServerName: viper.GetString("tls-server-name"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// set once here, since the docker driver shares the client between volumes
+	config.HttpClient.Timeout = viper.GetDuration("timeout")
+	return config, nil
+}
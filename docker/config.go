@@ -15,9 +15,22 @@
 package docker
 
 import (
+	"time"
+
+	"github.com/asteris-llc/vaultfs/fs"
 	"github.com/hashicorp/vault/api"
 )
 
+// Scopes a volume can have, as reported to Docker
+const (
+	// ScopeLocal volumes only exist on the node they were created on
+	ScopeLocal = "local"
+
+	// ScopeGlobal volumes are reported as existing on every node of a
+	// cluster, but must still be created on each with their options
+	ScopeGlobal = "global"
+)
+
 // Config configures the docker volume plugin
 type Config struct {
 	// Root for mount
@@ -26,4 +39,22 @@ type Config struct {
 	// Token and config for Vault
 	Token string
 	Vault *api.Config
+
+	// TokenFile is read for the token instead of using Token, if set
+	TokenFile string
+
+	// Format of secret files, unless overridden per volume
+	Format fs.Format
+
+	// CacheTTL is the longest time a response from Vault is reused
+	CacheTTL time.Duration
+
+	// Timeout bounds each request to Vault
+	Timeout time.Duration
+
+	// Auth logs in instead of using Token, if set
+	Auth fs.Authenticator
+
+	// Scope of the volumes, ScopeLocal if empty
+	Scope string
 }
@@ -15,68 +15,167 @@
 package docker
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"sync"
+	"time"
 
+	"bazil.org/fuse"
 	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/vaultfs/fs"
 	"github.com/docker/go-plugins-helpers/volume"
 )
 
-type volumeName struct {
-	name        string
-	connections int
-}
-
 // Driver implements the interface for a Docker volume plugin
 type Driver struct {
 	config  Config
 	servers map[string]*Server
-	volumes map[string]*volumeName
+	volumes map[string]*volumeState
 	m       *sync.Mutex
 }
 
-// New instantiates a new driver and returns it
-func New(config Config) Driver {
-	return Driver{
+// New instantiates a new driver and returns it. Volumes created before a
+// restart are loaded from the state file under the root, and mounts left
+// behind by a previous run are cleaned up.
+func New(config Config) (Driver, error) {
+	if err := os.MkdirAll(config.Root, 0755); err != nil {
+		return Driver{}, err
+	}
+
+	volumes, err := loadState(path.Join(config.Root, stateFile))
+	if err != nil {
+		return Driver{}, err
+	}
+
+	d := Driver{
 		config:  config,
 		servers: map[string]*Server{},
+		volumes: volumes,
 		m:       new(sync.Mutex),
 	}
+
+	if err := d.cleanup(); err != nil {
+		return Driver{}, err
+	}
+
+	logrus.WithField("volumes", len(volumes)).Info("loaded volumes")
+	return d, nil
+}
+
+// cleanup unmounts whatever is left mounted under the root, since the FUSE
+// servers died with the previous run. Directories of volumes that no longer
+// exist are removed; the rest are mounted again when Docker asks for them.
+func (d Driver) cleanup() error {
+	infos, err := ioutil.ReadDir(d.config.Root)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		mount := path.Join(d.config.Root, info.Name())
+		logger := logrus.WithField("mountpoint", mount)
+
+		if err := fuse.Unmount(mount); err == nil {
+			logger.Info("unmounted stale mount")
+		}
+
+		name, err := url.QueryUnescape(info.Name())
+		if _, ok := d.volumes[name]; ok && err == nil {
+			continue
+		}
+
+		if err := os.Remove(mount); err != nil {
+			logger.WithError(err).Warn("could not remove mountpoint of unknown volume")
+		}
+	}
+
+	return nil
+}
+
+// save writes the volume definitions to the state file
+func (d Driver) save() error {
+	return saveState(path.Join(d.config.Root, stateFile), d.volumes)
 }
 
-// Create handles volume creation calls
-func (d Driver) Create(r volume.Request) volume.Response {
-	return volume.Response{}
+// Create handles volume creation calls. Creating an existing volume again
+// succeeds, as Docker does when a container names a volume, unless different
+// options are given. In global scope new volumes need a root.
+func (d Driver) Create(r *volume.CreateRequest) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	logger := logrus.WithField("name", r.Name)
+	logger.Debug("got create request")
+
+	if v, ok := d.volumes[r.Name]; ok {
+		if len(r.Options) > 0 && !sameOptions(v.Options, r.Options) {
+			return fmt.Errorf("volume %s already exists with different options", r.Name)
+		}
+		return nil
+	}
+
+	// Docker creates a volume without options when a container names one it
+	// does not know. A global volume named on a node it was not created on
+	// would then serve the plugin's defaults instead of what it was meant to.
+	if d.config.Scope == ScopeGlobal && r.Options["root"] == "" {
+		return fmt.Errorf("global volume %s must be created with at least the root option", r.Name)
+	}
+
+	if _, err := d.volumeConfig(r.Name, r.Options); err != nil {
+		logger.WithError(err).Error("invalid volume options")
+		return err
+	}
+
+	d.volumes[r.Name] = &volumeState{
+		Name:      r.Name,
+		Options:   r.Options,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := d.save(); err != nil {
+		logger.WithError(err).Error("error saving volumes")
+		return err
+	}
+
+	return nil
 }
 
 // Get retrieves a volume
-func (d Driver) Get(r volume.Request) volume.Response {
+func (d Driver) Get(r *volume.GetRequest) (*volume.GetResponse, error) {
 	d.m.Lock()
 	defer d.m.Unlock()
-	m := d.mountpoint(r.Name)
-	if s, ok := d.volumes[m]; ok {
-		return volume.Response{Volume: &volume.Volume{Name: s.name, Mountpoint: d.mountpoint(s.name)}}
+
+	if _, err := d.lookup(r.Name); err != nil {
+		return nil, err
 	}
 
-	return volume.Response{Err: fmt.Sprintf("Unable to find volume mounted on %s", m)}
+	return &volume.GetResponse{Volume: d.volume(r.Name)}, nil
 }
 
-// List mounted volumes
-func (d Driver) List(r volume.Request) volume.Response {
+// List created volumes, whether mounted or not
+func (d Driver) List() (*volume.ListResponse, error) {
 	d.m.Lock()
 	defer d.m.Unlock()
-	var vols []*volume.Volume
-	for _, v := range d.volumes {
-		vols = append(vols, &volume.Volume{Name: v.name, Mountpoint: d.mountpoint(v.name)})
+
+	vols := []*volume.Volume{}
+	for name := range d.volumes {
+		vols = append(vols, d.volume(name))
 	}
-	return volume.Response{Volumes: vols}
+	return &volume.ListResponse{Volumes: vols}, nil
 }
 
-// Remove handles volume removal calls
-func (d Driver) Remove(r volume.Request) volume.Response {
+// Remove handles volume removal calls. Volumes still mounted by a container
+// cannot be removed.
+func (d Driver) Remove(r *volume.RemoveRequest) error {
 	d.m.Lock()
 	defer d.m.Unlock()
 	mount := d.mountpoint(r.Name)
@@ -86,37 +185,65 @@ func (d Driver) Remove(r volume.Request) volume.Response {
 	})
 	logger.Debug("got remove request")
 
+	if _, ok := d.volumes[r.Name]; !ok {
+		return fmt.Errorf("no such volume %s", r.Name)
+	}
+
 	if server, ok := d.servers[mount]; ok {
-		if server.connections <= 1 {
-			logger.Debug("removing server")
-			delete(d.servers, mount)
-		}
+		logger.WithField("consumers", server.Consumers()).Error("volume is in use")
+		return fmt.Errorf("volume %s is in use", r.Name)
+	}
+
+	if err := os.Remove(mount); err != nil && !os.IsNotExist(err) {
+		logger.WithError(err).Error("error removing mount directory")
+		return err
+	}
+
+	delete(d.volumes, r.Name)
+	if err := d.save(); err != nil {
+		logger.WithError(err).Error("error saving volumes")
+		return err
 	}
 
-	return volume.Response{}
+	return nil
 }
 
-// Path handles calls for mountpoints
-func (d Driver) Path(r volume.Request) volume.Response {
-	return volume.Response{Mountpoint: d.mountpoint(r.Name)}
+// Path handles calls for mountpoints. The mountpoint is empty unless the
+// volume is mounted.
+func (d Driver) Path(r *volume.PathRequest) (*volume.PathResponse, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if _, err := d.lookup(r.Name); err != nil {
+		return nil, err
+	}
+
+	return &volume.PathResponse{Mountpoint: d.volume(r.Name).Mountpoint}, nil
 }
 
-// Mount handles creating and mounting servers
-func (d Driver) Mount(r volume.Request) volume.Response {
+// Mount handles creating and mounting servers. Each volume has one server,
+// shared by every container that mounts it, which is told apart by the ID of
+// its mount.
+func (d Driver) Mount(r *volume.MountRequest) (*volume.MountResponse, error) {
 	d.m.Lock()
 	defer d.m.Unlock()
 
 	mount := d.mountpoint(r.Name)
 	logger := logrus.WithFields(logrus.Fields{
 		"name":       r.Name,
+		"id":         r.ID,
 		"mountpoint": mount,
 	})
 	logger.Info("mounting volume")
 
-	server, ok := d.servers[mount]
-	if ok && server.connections > 0 {
-		server.connections++
-		return volume.Response{Mountpoint: mount}
+	v, err := d.lookup(r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if server, ok := d.servers[mount]; ok {
+		server.Add(r.ID)
+		return &volume.MountResponse{Mountpoint: mount}, nil
 	}
 
 	mountInfo, err := os.Lstat(mount)
@@ -124,59 +251,243 @@ func (d Driver) Mount(r volume.Request) volume.Response {
 	if os.IsNotExist(err) {
 		if err := os.MkdirAll(mount, os.ModeDir|0444); err != nil {
 			logger.WithError(err).Error("error making mount directory")
-			return volume.Response{Err: err.Error()}
+			return nil, err
 		}
 	} else if err != nil {
 		logger.WithError(err).Error("error checking if directory exists")
-		return volume.Response{Err: err.Error()}
+		return nil, err
 	}
 
 	if mountInfo != nil && !mountInfo.IsDir() {
 		logger.Error("already exists and not a directory")
-		return volume.Response{Err: fmt.Sprintf("%s already exists and is not a directory", mount)}
+		return nil, fmt.Errorf("%s already exists and is not a directory", mount)
+	}
+
+	config, err := d.volumeConfig(r.Name, v.Options)
+	if err != nil {
+		logger.WithError(err).Error("invalid volume options")
+		return nil, err
 	}
 
-	server, err = NewServer(d.config.Vault, mount, d.config.Token, r.Name)
+	server, err := NewServer(d.config.Vault, mount, config.token, config.root, config.opts)
 	if err != nil {
 		logger.WithError(err).Error("error creating server")
-		return volume.Response{Err: err.Error()}
+		return nil, err
 	}
 
 	go server.Mount()
+	server.Add(r.ID)
 	d.servers[mount] = server
 
-	return volume.Response{Mountpoint: mount}
+	return &volume.MountResponse{Mountpoint: mount}, nil
 }
 
-// Unmount handles unmounting (but not removing) servers
-func (d Driver) Unmount(r volume.Request) volume.Response {
+// Unmount handles unmounting (but not removing) servers. The server is only
+// stopped when the last container using it unmounts. Unmounting a volume that
+// is not mounted succeeds, since after a restart Docker unmounts volumes
+// mounted before it.
+func (d Driver) Unmount(r *volume.UnmountRequest) error {
 	d.m.Lock()
 	defer d.m.Unlock()
 
 	mount := d.mountpoint(r.Name)
 	logger := logrus.WithFields(logrus.Fields{
 		"name":       r.Name,
+		"id":         r.ID,
 		"mountpoint": mount,
 	})
 	logger.Info("unmounting volume")
 
-	if server, ok := d.servers[mount]; ok {
-		logger.WithField("conns", server.connections).Debug("found server")
-		if server.connections == 1 {
-			logger.Debug("unmounting")
-			err := server.Unmount()
+	server, ok := d.servers[mount]
+	if !ok {
+		// the servers died with a previous run, and Docker still unmounts
+		// the volumes its containers had mounted
+		if _, ok := d.volumes[r.Name]; ok {
+			logger.Info("volume is not mounted, nothing to unmount")
+			return nil
+		}
+
+		logger.Error("could not find volume")
+		return fmt.Errorf("unable to find the volume mounted at %s", mount)
+	}
+
+	if !server.Remove(r.ID) {
+		logger.Error("volume is not mounted by this container")
+		return fmt.Errorf("volume %s is not mounted by %s", r.Name, r.ID)
+	}
+
+	if server.Used() {
+		logger.WithField("consumers", server.Consumers()).Debug("volume still in use")
+		return nil
+	}
+
+	// the server is dropped even if it fails to stop, since no container
+	// uses it any more and mounting the volume again starts a new one
+	logger.Debug("unmounting")
+	delete(d.servers, mount)
+	if err := server.Unmount(); err != nil {
+		logger.WithError(err).Error("error unmounting server")
+	}
+
+	return nil
+}
+
+// Capabilities tells Docker whether volumes are local to this node or exist
+// on every node of a cluster
+func (d Driver) Capabilities() *volume.CapabilitiesResponse {
+	scope := d.config.Scope
+	if scope == "" {
+		scope = ScopeLocal
+	}
+
+	return &volume.CapabilitiesResponse{Capabilities: volume.Capability{Scope: scope}}
+}
+
+// lookup returns the named volume. Volumes are only defined by Create, even
+// in global scope: the options of a volume created on another node are not
+// known here, and Create refuses global volumes without a root rather than
+// serving them with the plugin's defaults. Swarm creates service volumes on
+// each node with the options of the service.
+func (d Driver) lookup(name string) (*volumeState, error) {
+	if v, ok := d.volumes[name]; ok {
+		return v, nil
+	}
+
+	if d.config.Scope == ScopeGlobal {
+		return nil, fmt.Errorf("no such volume %s on this node, global volumes must be created on each node with their options", name)
+	}
+
+	return nil, fmt.Errorf("no such volume %s", name)
+}
+
+// volumeConfig is what a volume serves and how, as set by its options
+type volumeConfig struct {
+	root  string
+	token string
+	opts  fs.Options
+}
+
+// volumeConfig builds the config of a volume from the options given with
+// `docker volume create -o`. Options not given default to those of the
+// plugin, and the root defaults to the name of the volume.
+func (d Driver) volumeConfig(name string, raw map[string]string) (volumeConfig, error) {
+	config := volumeConfig{
+		root:  name,
+		token: d.config.Token,
+		opts: fs.Options{
+			Layout: fs.LayoutSecret,
+			Format: d.config.Format,
+			Write:  fs.WriteNone,
+
+			CacheTTL:  d.config.CacheTTL,
+			Timeout:   d.config.Timeout,
+			Auth:      d.config.Auth,
+			TokenFile: d.config.TokenFile,
+		},
+	}
+
+	for key, value := range raw {
+		switch key {
+		case "root":
+			config.root = value
+
+		case "token-file":
+			config.token = ""
+			config.opts.TokenFile = value
+			config.opts.Auth = nil
+
+		case "role":
+			// applied below, since it conflicts with token-file
+
+		case "format":
+			format, err := fs.ParseFormat(value)
 			if err != nil {
-				logger.WithError(err).Error("error unmounting server")
-				return volume.Response{Err: err.Error()}
+				return config, err
+			}
+			config.opts.Format = format
+
+		case "layout":
+			switch fs.Layout(value) {
+			case fs.LayoutSecret, fs.LayoutFields:
+				config.opts.Layout = fs.Layout(value)
+			default:
+				return config, fmt.Errorf("invalid layout %q, expected one of secret or fields", value)
+			}
+
+		case "kv-version":
+			version, err := strconv.Atoi(value)
+			if err != nil || version < 0 || version > 2 {
+				return config, fmt.Errorf("invalid kv-version %q, expected 1 or 2", value)
 			}
-			server.connections--
+			config.opts.KVVersion = version
+
+		default:
+			return config, fmt.Errorf("unknown volume option %q", key)
 		}
-	} else {
-		logger.Error("could not find volume")
-		return volume.Response{Err: fmt.Sprintf("unable to find the volume mounted at %s", mount)}
 	}
 
-	return volume.Response{}
+	if role, ok := raw["role"]; ok {
+		if _, ok := raw["token-file"]; ok {
+			return config, errors.New("only one of the role and token-file options may be set")
+		}
+
+		auth, err := withRole(d.config.Auth, role)
+		if err != nil {
+			return config, err
+		}
+		config.opts.Auth = auth
+	}
+
+	return config, nil
+}
+
+// withRole returns a copy of the given authenticator that logs in as the given
+// role
+func withRole(auth fs.Authenticator, role string) (fs.Authenticator, error) {
+	switch auth := auth.(type) {
+	case *fs.Cert:
+		withRole := *auth
+		withRole.Role = role
+		return &withRole, nil
+
+	case *fs.Kubernetes:
+		withRole := *auth
+		withRole.Role = role
+		return &withRole, nil
+	}
+
+	return nil, errors.New("the role option needs the plugin to use cert or kubernetes auth")
+}
+
+// sameOptions checks whether two sets of volume options are the same
+func sameOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// volume describes the named volume to Docker. The mountpoint and the IDs of
+// the mounts using it are only set while it is mounted.
+func (d Driver) volume(name string) *volume.Volume {
+	v := &volume.Volume{Name: name}
+	if state, ok := d.volumes[name]; ok {
+		v.CreatedAt = state.CreatedAt.Format(time.RFC3339)
+	}
+
+	if server, ok := d.servers[d.mountpoint(name)]; ok {
+		v.Mountpoint = d.mountpoint(name)
+		v.Status = map[string]interface{}{"consumers": server.Consumers()}
+	}
+
+	return v
 }
 
 func (d Driver) mountpoint(name string) string {
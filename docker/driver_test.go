@@ -0,0 +1,362 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/asteris-llc/vaultfs/fs"
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestDriver returns a driver with its root in a new temporary directory,
+// which must be removed by the caller
+func newTestDriver(t *testing.T, config Config) (Driver, string) {
+	dir, err := ioutil.TempDir("", "vaultfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Root = dir
+	d, err := New(config)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return d, dir
+}
+
+// volumeNames returns the sorted names of the listed volumes
+func volumeNames(t *testing.T, d Driver) []string {
+	list, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, v := range list.Volumes {
+		names = append(names, v.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDriverCreate(t *testing.T) {
+	d, dir := newTestDriver(t, Config{})
+	defer os.RemoveAll(dir)
+
+	options := map[string]string{"root": "secret/app", "format": "json"}
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		err     bool
+	}{
+		{"app", options, false},
+		{"app", map[string]string{"root": "secret/app", "format": "json"}, false},
+		{"app", nil, false},
+		{"app", map[string]string{"root": "secret/other"}, true},
+		{"bad", map[string]string{"unknown": "x"}, true},
+		{"bad", map[string]string{"layout": "tree"}, true},
+		{"plain", nil, false},
+	}
+
+	for _, tt := range tests {
+		err := d.Create(&volume.CreateRequest{Name: tt.name, Options: tt.options})
+		if tt.err && err == nil {
+			t.Errorf("%s %v: expected an error", tt.name, tt.options)
+		} else if !tt.err && err != nil {
+			t.Errorf("%s %v: %s", tt.name, tt.options, err)
+		}
+	}
+
+	if got, want := volumeNames(t, d), []string{"app", "plain"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got volumes %v, want %v", got, want)
+	}
+
+	// creating again keeps the options the volume was first created with
+	if got := d.volumes["app"].Options; !reflect.DeepEqual(got, options) {
+		t.Errorf("got options %v, want %v", got, options)
+	}
+}
+
+func TestDriverGet(t *testing.T) {
+	d, dir := newTestDriver(t, Config{})
+	defer os.RemoveAll(dir)
+
+	if err := d.Create(&volume.CreateRequest{Name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Get(&volume.GetRequest{Name: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Volume.Name != "app" || resp.Volume.CreatedAt == "" {
+		t.Errorf("got %+v, want app with a creation time", resp.Volume)
+	}
+	if resp.Volume.Mountpoint != "" {
+		t.Errorf("got mountpoint %q, want none until mounted", resp.Volume.Mountpoint)
+	}
+
+	if _, err := d.Get(&volume.GetRequest{Name: "missing"}); err == nil {
+		t.Error("expected an error getting a missing volume")
+	}
+}
+
+func TestDriverRemove(t *testing.T) {
+	d, dir := newTestDriver(t, Config{})
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"app", "web"} {
+		if err := d.Create(&volume.CreateRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mount := d.mountpoint("app")
+	if err := os.Mkdir(mount, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Remove(&volume.RemoveRequest{Name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mount); !os.IsNotExist(err) {
+		t.Errorf("mountpoint was not removed: %v", err)
+	}
+
+	if got, want := volumeNames(t, d), []string{"web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got volumes %v, want %v", got, want)
+	}
+
+	if err := d.Remove(&volume.RemoveRequest{Name: "app"}); err == nil {
+		t.Error("expected an error removing a removed volume")
+	}
+
+	// removed volumes stay removed after a restart
+	d, err := New(d.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := volumeNames(t, d), []string{"web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after restart got volumes %v, want %v", got, want)
+	}
+}
+
+func TestDriverRemoveInUse(t *testing.T) {
+	d, dir := newTestDriver(t, Config{})
+	defer os.RemoveAll(dir)
+
+	if err := d.Create(&volume.CreateRequest{Name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	d.servers[d.mountpoint("app")] = &Server{consumers: map[string]int{"first": 1}}
+
+	if err := d.Remove(&volume.RemoveRequest{Name: "app"}); err == nil {
+		t.Error("expected an error removing a volume in use")
+	}
+	if got, want := volumeNames(t, d), []string{"app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got volumes %v, want %v", got, want)
+	}
+}
+
+func TestDriverRestart(t *testing.T) {
+	d, dir := newTestDriver(t, Config{})
+	defer os.RemoveAll(dir)
+
+	options := map[string]string{"root": "secret/app"}
+	if err := d.Create(&volume.CreateRequest{Name: "app", Options: options}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mountpoint of a volume that no longer exists is removed on startup
+	stale := d.mountpoint("stale")
+	if err := os.Mkdir(stale, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(d.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := volumeNames(t, d), []string{"app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got volumes %v, want %v", got, want)
+	}
+	if got := d.volumes["app"].Options; !reflect.DeepEqual(got, options) {
+		t.Errorf("got options %v, want %v", got, options)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale mountpoint was not removed: %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vaultfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, stateFile)
+
+	volumes, err := loadState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 0 {
+		t.Errorf("got %v from a missing file, want no volumes", volumes)
+	}
+
+	created := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := map[string]*volumeState{
+		"app":   {Name: "app", Options: map[string]string{"root": "secret/app"}, CreatedAt: created},
+		"plain": {Name: "plain", CreatedAt: created},
+	}
+
+	if err := saveState(file, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// only the state file is left, without temporary files
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != stateFile {
+		t.Errorf("got %d files in the root, want only the state file", len(infos))
+	}
+
+	if err := ioutil.WriteFile(file, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(file); err == nil {
+		t.Error("expected an error loading an invalid file")
+	}
+}
+
+func TestDriverUnmount(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {"ttl": 0}}`))
+	}))
+	defer vault.Close()
+
+	config := api.DefaultConfig()
+	config.Address = vault.URL
+
+	d, dir := newTestDriver(t, Config{Vault: config})
+	defer os.RemoveAll(dir)
+
+	if err := d.Create(&volume.CreateRequest{Name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server is never mounted, so stopping it fails
+	mount := d.mountpoint("app")
+	server, err := NewServer(config, mount, "token", "secret/app", fs.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Add("first")
+	server.Add("second")
+	d.servers[mount] = server
+
+	tests := []struct {
+		id      string
+		err     bool
+		mounted bool
+	}{
+		{"third", true, true},
+		{"first", false, true},
+		{"first", true, true},
+		{"second", false, false},
+
+		// a volume without a server unmounts, as it does after a restart
+		{"second", false, false},
+	}
+
+	for _, tt := range tests {
+		err := d.Unmount(&volume.UnmountRequest{Name: "app", ID: tt.id})
+		if tt.err && err == nil {
+			t.Errorf("unmounting %s: expected an error", tt.id)
+		} else if !tt.err && err != nil {
+			t.Errorf("unmounting %s: %s", tt.id, err)
+		}
+
+		if _, ok := d.servers[mount]; ok != tt.mounted {
+			t.Errorf("after unmounting %s: got mounted %v, want %v", tt.id, ok, tt.mounted)
+		}
+	}
+
+	if err := d.Unmount(&volume.UnmountRequest{Name: "missing", ID: "first"}); err == nil {
+		t.Error("expected an error unmounting a missing volume")
+	}
+}
+
+func TestDriverCreateGlobal(t *testing.T) {
+	d, dir := newTestDriver(t, Config{Scope: ScopeGlobal})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		err     bool
+	}{
+		{"app", nil, true},
+		{"app", map[string]string{"format": "json"}, true},
+		{"app", map[string]string{"root": ""}, true},
+		{"app", map[string]string{"root": "secret/app"}, false},
+
+		// a container naming an existing volume creates it without options
+		{"app", nil, false},
+	}
+
+	for _, tt := range tests {
+		err := d.Create(&volume.CreateRequest{Name: tt.name, Options: tt.options})
+		if tt.err && err == nil {
+			t.Errorf("%s %v: expected an error", tt.name, tt.options)
+		} else if !tt.err && err != nil {
+			t.Errorf("%s %v: %s", tt.name, tt.options, err)
+		}
+	}
+
+	if got, want := volumeNames(t, d), []string{"app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got volumes %v, want %v", got, want)
+	}
+
+	if _, err := d.Get(&volume.GetRequest{Name: "other"}); err == nil {
+		t.Error("expected an error getting a volume not created on this node")
+	}
+}
@@ -15,27 +15,67 @@
 package docker
 
 import (
+	"sort"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/asteris-llc/vaultfs/fs"
 	"github.com/hashicorp/vault/api"
 )
 
-// Server wraps VaultFS and tracks connection counts
+// Server wraps VaultFS and tracks the mounts using it
 type Server struct {
-	fs          *fs.VaultFS
-	connections int
-	stopFunc    func()
-	errs        chan error
+	fs        *fs.VaultFS
+	consumers map[string]int
+	stopFunc  func()
+	errs      chan error
 }
 
 // NewServer returns a new server with initial state
-func NewServer(config *api.Config, mountpoint, token, root string) (*Server, error) {
-	fs, err := fs.New(config, mountpoint, token, root)
+func NewServer(config *api.Config, mountpoint, token, root string, opts fs.Options) (*Server, error) {
+	fs, err := fs.New(config, mountpoint, token, root, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Server{fs: fs, connections: 1}, nil
+	return &Server{fs: fs, consumers: map[string]int{}}, nil
+}
+
+// Add records that the mount with the given ID uses the server. Older Docker
+// versions send no IDs, so mounts without one are only counted.
+func (s *Server) Add(id string) {
+	s.consumers[id]++
+}
+
+// Remove records that the mount with the given ID no longer uses the server.
+// It returns false if no such mount uses it.
+func (s *Server) Remove(id string) bool {
+	if s.consumers[id] == 0 {
+		return false
+	}
+
+	s.consumers[id]--
+	if s.consumers[id] == 0 {
+		delete(s.consumers, id)
+	}
+	return true
+}
+
+// Used checks whether any mount uses the server
+func (s *Server) Used() bool {
+	return len(s.consumers) > 0
+}
+
+// Consumers returns the IDs of the mounts using the server
+func (s *Server) Consumers() []string {
+	ids := []string{}
+	for id := range s.consumers {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+	return ids
 }
 
 // Mount mounts the wrapped FS on a given mountpoint. It also starts watching
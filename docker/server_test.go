@@ -0,0 +1,80 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServerConsumers(t *testing.T) {
+	s := &Server{consumers: map[string]int{}}
+
+	s.Add("first")
+	s.Add("second")
+	s.Add("second")
+	if !s.Used() {
+		t.Error("expected the server to be used")
+	}
+	if got, want := s.Consumers(), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got consumers %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		id        string
+		removed   bool
+		consumers []string
+	}{
+		{"third", false, []string{"first", "second"}},
+		{"first", true, []string{"second"}},
+		{"first", false, []string{"second"}},
+		{"second", true, []string{"second"}},
+		{"second", true, []string{}},
+		{"second", false, []string{}},
+	}
+
+	for _, tt := range tests {
+		if removed := s.Remove(tt.id); removed != tt.removed {
+			t.Errorf("removing %s: got %v, want %v", tt.id, removed, tt.removed)
+		}
+		if got := s.Consumers(); !reflect.DeepEqual(got, tt.consumers) {
+			t.Errorf("after removing %s: got consumers %v, want %v", tt.id, got, tt.consumers)
+		}
+	}
+
+	if s.Used() {
+		t.Error("expected the server to be unused")
+	}
+}
+
+func TestServerWithoutIDs(t *testing.T) {
+	s := &Server{consumers: map[string]int{}}
+
+	// older Docker versions send no IDs, so their mounts are only counted
+	s.Add("")
+	s.Add("")
+	if got := s.Consumers(); len(got) != 0 {
+		t.Errorf("got consumers %v, want none", got)
+	}
+
+	for i := 0; i < 2; i++ {
+		if !s.Used() || !s.Remove("") {
+			t.Fatalf("expected mount %d to be removed", i)
+		}
+	}
+	if s.Used() {
+		t.Error("expected the server to be unused")
+	}
+}
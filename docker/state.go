@@ -0,0 +1,90 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// stateFile holds the volume definitions under the root. Docker volume names
+// cannot start with a dot, so it never clashes with a mountpoint.
+const stateFile = ".vaultfs-volumes.json"
+
+// volumeState is the definition of a volume, which is kept across restarts
+type volumeState struct {
+	Name      string            `json:"name"`
+	Options   map[string]string `json:"options,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// loadState reads the volume definitions from the given file. A missing file
+// means there are none.
+func loadState(file string) (map[string]*volumeState, error) {
+	volumes := map[string]*volumeState{}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return volumes, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var list []*volumeState
+	if err := json.Unmarshal(content, &list); err != nil {
+		return nil, err
+	}
+
+	for _, v := range list {
+		volumes[v.Name] = v
+	}
+
+	return volumes, nil
+}
+
+// saveState writes the volume definitions to the given file. The file is
+// replaced by renaming, so a crash never leaves it half written.
+func saveState(file string, volumes map[string]*volumeState) error {
+	list := []*volumeState{}
+	for _, v := range volumes {
+		list = append(list, v)
+	}
+
+	content, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(file), path.Base(file))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,181 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Authenticator logs in to Vault, for auth methods other than a static token
+type Authenticator interface {
+	// Login logs in with the given client, which has no token, and returns
+	// the resulting token
+	Login(client *api.Client) (*api.SecretAuth, error)
+}
+
+// AppRole logs in with the AppRole auth method. The secret ID is read from a
+// file on every login, so it can be rotated without restarting.
+type AppRole struct {
+	// Mount is the path the auth method is mounted at, "approle" if empty
+	Mount string
+
+	RoleID       string
+	SecretIDFile string
+}
+
+// Login logs in with the role and secret IDs
+func (a *AppRole) Login(client *api.Client) (*api.SecretAuth, error) {
+	secretID, err := ioutil.ReadFile(a.SecretIDFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginWrite(client, a.Mount, "approle", map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": strings.TrimSpace(string(secretID)),
+	})
+}
+
+// Cert logs in with the cert auth method, using the client certificate
+// configured for TLS
+type Cert struct {
+	// Mount is the path the auth method is mounted at, "cert" if empty
+	Mount string
+
+	// Role is the name of the certificate role to log in against. All roles
+	// are tried if it is empty.
+	Role string
+}
+
+// Login logs in with the client certificate
+func (c *Cert) Login(client *api.Client) (*api.SecretAuth, error) {
+	data := map[string]interface{}{}
+	if c.Role != "" {
+		data["name"] = c.Role
+	}
+
+	return loginWrite(client, c.Mount, "cert", data)
+}
+
+// DefaultJWTFile is where Kubernetes projects the service account token into a
+// pod
+const DefaultJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Kubernetes logs in with the kubernetes auth method, using a service account
+// token. The token is read from a file on every login, since Kubernetes
+// rotates projected tokens.
+type Kubernetes struct {
+	// Mount is the path the auth method is mounted at, "kubernetes" if empty
+	Mount string
+
+	Role string
+
+	// JWTFile holds the service account token, DefaultJWTFile if empty
+	JWTFile string
+}
+
+// Login logs in with the service account token
+func (k *Kubernetes) Login(client *api.Client) (*api.SecretAuth, error) {
+	file := k.JWTFile
+	if file == "" {
+		file = DefaultJWTFile
+	}
+
+	jwt, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginWrite(client, k.Mount, "kubernetes", map[string]interface{}{
+		"role": k.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
+
+// Unwrap exchanges a response-wrapping token for the token it wraps. The
+// wrapping token must have been created at the given path, so that a wrapping
+// token substituted by someone who used the original is refused. A wrapping
+// token can only be used once, so it fails to unwrap if it was intercepted.
+func Unwrap(config *api.Config, wrapping, creationPath string) (string, error) {
+	client, err := api.NewClient(config)
+	if err != nil {
+		return "", err
+	}
+	client.ClearToken()
+
+	info, err := client.Logical().Write("sys/wrapping/lookup", map[string]interface{}{
+		"token": wrapping,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not look up wrapping token, it may have been used already: %s", err)
+	}
+
+	if info == nil {
+		return "", errors.New("wrapping token lookup returned nothing")
+	}
+
+	if p, _ := info.Data["creation_path"].(string); p != creationPath {
+		return "", fmt.Errorf("wrapping token was created at %q, expected %q", p, creationPath)
+	}
+
+	client.SetToken(wrapping)
+	secret, err := client.Logical().Write("sys/wrapping/unwrap", map[string]interface{}{})
+	if err != nil {
+		return "", fmt.Errorf("could not unwrap token, it may have been used already: %s", err)
+	}
+
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", errors.New("wrapped response did not contain a token")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+// loginWrite writes to the login endpoint of an auth method and returns the
+// resulting token
+func loginWrite(client *api.Client, mount, method string, data map[string]interface{}) (*api.SecretAuth, error) {
+	if mount == "" {
+		mount = method
+	}
+
+	secret, err := client.Logical().Write(path.Join("auth", mount, "login"), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errors.New("login response did not contain a token")
+	}
+
+	return secret.Auth, nil
+}
+
+// login logs in with a new client for the given config, so that the token of
+// a client in use is not sent to the login endpoint
+func login(config *api.Config, auth Authenticator) (*api.SecretAuth, error) {
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	client.ClearToken()
+
+	return auth.Login(client)
+}
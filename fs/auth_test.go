@@ -0,0 +1,214 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKubernetesLogin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vaultfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jwtFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(jwtFile, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		auth     Kubernetes
+		response string
+		path     string
+		token    string
+		err      bool
+	}{
+		{
+			name:     "default mount",
+			auth:     Kubernetes{Role: "app", JWTFile: jwtFile},
+			response: `{"auth": {"client_token": "login-token", "lease_duration": 3600, "renewable": true}}`,
+			path:     "/v1/auth/kubernetes/login",
+			token:    "login-token",
+		},
+		{
+			name:     "custom mount",
+			auth:     Kubernetes{Mount: "k8s/prod", Role: "app", JWTFile: jwtFile},
+			response: `{"auth": {"client_token": "login-token"}}`,
+			path:     "/v1/auth/k8s/prod/login",
+			token:    "login-token",
+		},
+		{
+			name:     "missing token",
+			auth:     Kubernetes{Role: "app", JWTFile: jwtFile},
+			response: `{"auth": null}`,
+			path:     "/v1/auth/kubernetes/login",
+			err:      true,
+		},
+		{
+			name: "missing JWT file",
+			auth: Kubernetes{Role: "app", JWTFile: filepath.Join(dir, "missing")},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		var (
+			path  string
+			token string
+			body  map[string]string
+		)
+		server, config, _ := newTestVault(t, func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			token = r.Header.Get("X-Vault-Token")
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("%s: decoding request: %s", test.name, err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(test.response))
+		})
+
+		auth, err := login(config, &test.auth)
+		server.Close()
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if auth.ClientToken != test.token {
+			t.Errorf("%s: token = %q, want %q", test.name, auth.ClientToken, test.token)
+		}
+
+		if path != test.path {
+			t.Errorf("%s: path = %q, want %q", test.name, path, test.path)
+		}
+		if test.path == "" {
+			continue
+		}
+		if token != "" {
+			t.Errorf("%s: login sent token %q", test.name, token)
+		}
+		if body["role"] != "app" || body["jwt"] != "service-account-jwt" {
+			t.Errorf("%s: body = %v, want role app and the trimmed JWT", test.name, body)
+		}
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	tests := []struct {
+		name         string
+		creationPath string
+		lookup       int
+		unwrap       string
+		token        string
+		unwrapped    bool
+		err          bool
+	}{
+		{
+			name:         "matching creation path",
+			creationPath: "auth/approle/role/app/secret-id",
+			lookup:       http.StatusOK,
+			unwrap:       `{"auth": {"client_token": "unwrapped-token"}}`,
+			token:        "unwrapped-token",
+			unwrapped:    true,
+		},
+		{
+			name:         "other creation path",
+			creationPath: "secret/other",
+			lookup:       http.StatusOK,
+			err:          true,
+		},
+		{
+			name:         "used wrapping token",
+			creationPath: "auth/approle/role/app/secret-id",
+			lookup:       http.StatusBadRequest,
+			err:          true,
+		},
+		{
+			name:         "no token in response",
+			creationPath: "auth/approle/role/app/secret-id",
+			lookup:       http.StatusOK,
+			unwrap:       `{"data": {"secret_id": "x"}}`,
+			unwrapped:    true,
+			err:          true,
+		},
+	}
+
+	for _, test := range tests {
+		unwrapped := false
+		server, config, _ := newTestVault(t, func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("X-Vault-Token")
+			w.Header().Set("Content-Type", "application/json")
+
+			switch r.URL.Path {
+			case "/v1/sys/wrapping/lookup":
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("%s: decoding request: %s", test.name, err)
+				}
+				if token != "" || body["token"] != "wrapping-token" {
+					t.Errorf("%s: lookup sent token %q and body %v", test.name, token, body)
+				}
+
+				w.WriteHeader(test.lookup)
+				if test.lookup != http.StatusOK {
+					w.Write([]byte(`{"errors": ["wrapping token is not valid or does not exist"]}`))
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": map[string]interface{}{"creation_path": test.creationPath},
+				})
+
+			case "/v1/sys/wrapping/unwrap":
+				unwrapped = true
+				if token != "wrapping-token" {
+					t.Errorf("%s: unwrap sent token %q", test.name, token)
+				}
+				w.Write([]byte(test.unwrap))
+
+			default:
+				t.Errorf("%s: unexpected request to %s", test.name, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		token, err := Unwrap(config, "wrapping-token", "auth/approle/role/app/secret-id")
+		server.Close()
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if token != test.token {
+			t.Errorf("%s: token = %q, want %q", test.name, token, test.token)
+		}
+
+		// a wrapping token from elsewhere must not be used up
+		if unwrapped != test.unwrapped {
+			t.Errorf("%s: unwrapped = %v, want %v", test.name, unwrapped, test.unwrapped)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// Backend stores the secrets shown in the filesystem. Paths are full paths,
+// including the root the filesystem was mounted with. Implementations must be
+// safe for concurrent use and should give up when the context is done.
+type Backend interface {
+	// Read returns the secret at the given path, or nil if there is none
+	Read(ctx context.Context, path string) (*api.Secret, error)
+
+	// List returns the keys directly under the given prefix. Keys for nested
+	// prefixes end with a slash.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Write stores data at the given path
+	Write(ctx context.Context, path string, data map[string]interface{}) error
+
+	// Delete removes the secret at the given path
+	Delete(ctx context.Context, path string) error
+
+	// Metadata returns information about the secret at the given path, or nil
+	// if the backend does not keep any
+	Metadata(ctx context.Context, path string) (*Metadata, error)
+}
+
+// VersionReader is implemented by backends that keep earlier versions of
+// secrets, listed in their Metadata
+type VersionReader interface {
+	// ReadVersion returns the given version of the secret at the given path,
+	// or nil if it has been deleted or destroyed
+	ReadVersion(ctx context.Context, path string, version int) (*api.Secret, error)
+}
+
+// Metadata describes a secret beyond its data. Zero times are unknown.
+type Metadata struct {
+	Created time.Time
+	Updated time.Time
+
+	// Versions are sorted by number, oldest first
+	Versions []Version
+}
+
+// Version describes a single version of a secret
+type Version struct {
+	Number    int
+	Created   time.Time
+	Deleted   time.Time
+	Destroyed bool
+}
+
+type byNumber []Version
+
+func (v byNumber) Len() int           { return len(v) }
+func (v byNumber) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byNumber) Less(i, j int) bool { return v[i].Number < v[j].Number }
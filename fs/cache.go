@@ -0,0 +1,148 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cache holds backend responses by path until their lease or the maximum TTL
+// runs out, whichever comes first. Missing paths are cached as nil responses,
+// so repeated lookups of names that do not exist are also answered locally.
+// A nil cache caches nothing.
+type cache struct {
+	m       sync.Mutex
+	maxTTL  time.Duration
+	entries map[cacheKey]cacheEntry
+	swept   time.Time
+}
+
+type cacheKey struct {
+	op   string
+	path string
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// newCache creates a cache with the given maximum TTL, or nil if the TTL is
+// not positive
+func newCache(maxTTL time.Duration) *cache {
+	if maxTTL <= 0 {
+		return nil
+	}
+
+	return &cache{
+		maxTTL:  maxTTL,
+		entries: map[cacheKey]cacheEntry{},
+	}
+}
+
+// get returns a cached response and whether one was found
+func (c *cache) get(op, p string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	key := cacheKey{op, p}
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// put caches a response, which may be nil for a missing path, for the given
+// lease or the maximum TTL if it is shorter or the lease is zero
+func (c *cache) put(op, p string, value interface{}, lease time.Duration) {
+	if c == nil {
+		return
+	}
+
+	ttl := c.maxTTL
+	if lease > 0 && lease < ttl {
+		ttl = lease
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := time.Now()
+	c.entries[cacheKey{op, p}] = cacheEntry{
+		value:   value,
+		expires: now.Add(ttl),
+	}
+
+	// entries are otherwise only dropped when read again, which names that
+	// are looked up once, like editor swap files, never are
+	if now.Sub(c.swept) > c.maxTTL {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.swept = now
+	}
+}
+
+// invalidate forgets the given path and the listings of all of its parents,
+// which may gain or lose an entry when the path is written or deleted
+func (c *cache) invalidate(p string) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	delete(c.entries, cacheKey{opRead, p})
+	delete(c.entries, cacheKey{opList, p})
+	delete(c.entries, cacheKey{opMetadata, p})
+	for dir := p; dir != ""; {
+		if i := strings.LastIndex(dir, "/"); i >= 0 {
+			dir = dir[:i]
+		} else {
+			dir = ""
+		}
+		delete(c.entries, cacheKey{opList, dir})
+	}
+}
+
+// cleanPath normalises a Vault path, so that the same path always has the
+// same cache key. Vault paths have no leading or trailing slashes, and the
+// top of a mount is the empty path.
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+const (
+	opRead     = "read"
+	opList     = "list"
+	opMetadata = "metadata"
+)
@@ -0,0 +1,171 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+func TestCacheGetPut(t *testing.T) {
+	c := newCache(time.Minute)
+
+	if _, ok := c.get(opRead, "a"); ok {
+		t.Error("empty cache returned an entry")
+	}
+
+	c.put(opRead, "a", "value", 0)
+	c.put(opRead, "missing", nil, 0)
+	c.put(opRead, "leased", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		op, path string
+		value    interface{}
+		ok       bool
+	}{
+		{opRead, "a", "value", true},
+		{opList, "a", nil, false},
+		{opRead, "missing", nil, true},
+		{opRead, "leased", nil, false},
+	}
+
+	for _, tt := range tests {
+		value, ok := c.get(tt.op, tt.path)
+		if ok != tt.ok || value != tt.value {
+			t.Errorf("get(%s, %s) = %v, %v, want %v, %v", tt.op, tt.path, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestCacheNil(t *testing.T) {
+	c := newCache(0)
+	if c != nil {
+		t.Fatal("cache with zero TTL is not nil")
+	}
+
+	c.put(opRead, "a", "value", 0)
+	c.invalidate("a")
+	if _, ok := c.get(opRead, "a"); ok {
+		t.Error("nil cache returned an entry")
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	tests := []struct {
+		path string
+		gone []cacheKey
+		kept []cacheKey
+	}{
+		{
+			path: "secret/app/db",
+			gone: []cacheKey{{opRead, "secret/app/db"}, {opMetadata, "secret/app/db"}, {opList, "secret/app"}, {opList, "secret"}, {opList, ""}},
+			kept: []cacheKey{{opRead, "secret/app"}, {opList, "secret/other"}},
+		},
+		{
+			path: "db",
+			gone: []cacheKey{{opRead, "db"}, {opList, ""}},
+			kept: []cacheKey{{opList, "secret"}},
+		},
+	}
+
+	for _, tt := range tests {
+		c := newCache(time.Minute)
+		for _, key := range append(tt.gone, tt.kept...) {
+			c.put(key.op, key.path, "value", 0)
+		}
+
+		c.invalidate(tt.path)
+
+		for _, key := range tt.gone {
+			if _, ok := c.get(key.op, key.path); ok {
+				t.Errorf("invalidate(%s) kept %v", tt.path, key)
+			}
+		}
+		for _, key := range tt.kept {
+			if _, ok := c.get(key.op, key.path); !ok {
+				t.Errorf("invalidate(%s) dropped %v", tt.path, key)
+			}
+		}
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	c := newCache(time.Millisecond)
+	for _, p := range []string{"a", "b", "c"} {
+		c.put(opRead, p, nil, 0)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	c.put(opRead, "d", nil, 0)
+
+	if len(c.entries) != 1 {
+		t.Errorf("got %d entries after sweeping, want 1", len(c.entries))
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := map[string]string{
+		"":              "",
+		"/":             "",
+		"secret":        "secret",
+		"secret/":       "secret",
+		"/secret/app/":  "secret/app",
+		"secret//app/.": "secret/app",
+	}
+
+	for in, want := range tests {
+		if got := cleanPath(in); got != want {
+			t.Errorf("cleanPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRootCacheAfterRemove(t *testing.T) {
+	for _, rootPath := range []string{"secret", "secret/", "/secret/"} {
+		backend := NewMemory()
+		backend.Write(context.Background(), "secret/a", map[string]interface{}{"value": "a"})
+		backend.Write(context.Background(), "secret/b", map[string]interface{}{"value": "b"})
+
+		root := NewRoot(rootPath, backend, Options{
+			Layout:      LayoutSecret,
+			Write:       WriteNone,
+			AllowDelete: true,
+			CacheTTL:    time.Minute,
+		})
+		ctx := context.Background()
+
+		if _, err := root.ReadDirAll(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := root.Remove(ctx, &fuse.RemoveRequest{Name: "a"}); err != nil {
+			t.Fatalf("%s: %s", rootPath, err)
+		}
+
+		dirs, err := root.ReadDirAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := names(dirs), []string{"b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", rootPath, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// Dir implements both Node and Handle for a Vault prefix
+type Dir struct {
+	root  *Root
+	path  string
+	inode uint64
+}
+
+// NewDir creates a new directory for the given prefix and returns it
+func NewDir(root *Root, path string, inode uint64) *Dir {
+	return &Dir{
+		root:  root,
+		path:  path,
+		inode: inode,
+	}
+}
+
+// Attr sets attrs on the given fuse.Attr
+func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
+	logrus.WithField("path", d.path).Debug("handling Dir.Attr call")
+	a.Inode = d.inode
+	a.Mode = os.ModeDir | d.root.dirMode()
+	return nil
+}
+
+// Lookup looks up a path. Secrets take precedence over prefixes of the same
+// name, since a FUSE directory cannot also be read as a file. Names that do
+// not exist may select a format for a secret by extension, like db.json.
+func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	p := path.Join(d.path, name)
+	logger := logrus.WithFields(logrus.Fields{"root": d.path, "name": name})
+	logger.Debug("handling Dir.Lookup call")
+
+	secret, err := d.root.read(ctx, p)
+	if err != nil {
+		logger.WithError(err).Error("error reading key")
+		return nil, errno(err)
+	}
+
+	if secret != nil {
+		return d.root.secret(p, secret), nil
+	}
+
+	keys, err := d.root.list(ctx, p)
+	if err != nil {
+		logger.WithError(err).Error("error listing prefix")
+		return nil, errno(err)
+	}
+
+	if len(keys) > 0 {
+		return NewDir(d.root, p, d.root.inodes.get(p+"/")), nil
+	}
+
+	if name == versionsDir && d.root.opts.Layout != LayoutFields {
+		if node := d.root.history(d.path); node != nil {
+			return node, nil
+		}
+	}
+
+	node, err := d.lookupFormat(ctx, name)
+	if err != nil {
+		logger.WithError(err).Error("error reading key")
+		return nil, errno(err)
+	}
+
+	if node == nil {
+		return nil, fuse.ENOENT
+	}
+
+	return node, nil
+}
+
+// lookupFormat looks up a secret by a virtual name with a format extension.
+// It returns nil if the name does not select a format for an existing secret.
+// Virtual names are read-only.
+func (d *Dir) lookupFormat(ctx context.Context, name string) (fs.Node, error) {
+	if d.root.opts.Layout == LayoutFields {
+		return nil, nil
+	}
+
+	ext := path.Ext(name)
+	format, ok := extensions[ext]
+	if !ok || ext == name {
+		return nil, nil
+	}
+
+	p := path.Join(d.path, strings.TrimSuffix(name, ext))
+	secret, err := d.root.read(ctx, p)
+	if err != nil || secret == nil {
+		return nil, err
+	}
+
+	node := NewSecret(d.root, p, secret, d.root.inodes.get(path.Join(d.path, name)))
+	node.format = format
+	node.readOnly = true
+
+	return node, nil
+}
+
+// ReadDirAll returns a list of secrets and prefixes
+func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	logrus.WithField("root", d.path).Debug("handling Dir.ReadDirAll call")
+
+	keys, err := d.root.list(ctx, d.path)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"root": d.path}).Error("error reading secrets")
+		return nil, errno(err)
+	}
+
+	secrets := map[string]bool{}
+	for _, key := range keys {
+		secrets[key] = true
+	}
+
+	dirs := []fuse.Dirent{}
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			name := strings.TrimSuffix(key, "/")
+
+			// shadowed by a secret of the same name, see Lookup
+			if secrets[name] {
+				continue
+			}
+
+			dirs = append(dirs, fuse.Dirent{
+				Name:  name,
+				Inode: d.root.inodes.get(path.Join(d.path, name) + "/"),
+				Type:  fuse.DT_Dir,
+			})
+			continue
+		}
+
+		ent := fuse.Dirent{
+			Name:  key,
+			Inode: d.root.inodes.get(path.Join(d.path, key)),
+			Type:  fuse.DT_File,
+		}
+		if d.root.opts.Layout == LayoutFields {
+			ent.Type = fuse.DT_Dir
+		}
+
+		dirs = append(dirs, ent)
+	}
+
+	return dirs, nil
+}
+
+// Create creates a new secret, which is stored when it is first flushed. In
+// the fields layout secrets are directories, so they are created with Mkdir.
+func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	p := path.Join(d.path, req.Name)
+	logrus.WithField("path", p).Debug("handling Dir.Create call")
+
+	if d.root.opts.Write == WriteNone {
+		return nil, nil, errReadOnly
+	}
+
+	if d.root.opts.Layout == LayoutFields {
+		return nil, nil, fuse.EPERM
+	}
+
+	secret := NewSecret(d.root, p, &api.Secret{Data: map[string]interface{}{}}, d.root.inodes.get(p))
+	resp.Flags |= fuse.OpenDirectIO
+	return secret, secret.open(nil, secret.commit), nil
+}
+
+// Mkdir creates a new prefix, or a new secret in the fields layout. Vault has
+// no empty prefixes or secrets, so nothing is stored until a file is written
+// inside the new directory.
+func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	p := path.Join(d.path, req.Name)
+	logrus.WithField("path", p).Debug("handling Dir.Mkdir call")
+
+	if d.root.opts.Write == WriteNone {
+		return nil, errReadOnly
+	}
+
+	if d.root.opts.Layout == LayoutFields {
+		return NewFields(d.root, p, &api.Secret{Data: map[string]interface{}{}}, d.root.inodes.get(p)), nil
+	}
+
+	return NewDir(d.root, p, d.root.inodes.get(p+"/")), nil
+}
+
+// Remove deletes a secret. Removing a directory only succeeds if it is empty,
+// since Vault prefixes disappear along with their last secret. Virtual names
+// with a format extension cannot be removed, only the secret itself.
+func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	p := path.Join(d.path, req.Name)
+	logger := logrus.WithFields(logrus.Fields{"root": d.path, "name": req.Name})
+	logger.Debug("handling Dir.Remove call")
+
+	if !d.root.opts.AllowDelete {
+		return fuse.EPERM
+	}
+
+	if req.Dir {
+		keys, err := d.root.list(ctx, p)
+		if err != nil {
+			logger.WithError(err).Error("error listing prefix")
+			return errno(err)
+		}
+
+		if len(keys) > 0 {
+			return errNotEmpty
+		}
+
+		if d.root.opts.Layout != LayoutFields {
+			return nil
+		}
+
+		secret, err := d.root.read(ctx, p)
+		if err != nil {
+			logger.WithError(err).Error("error reading key")
+			return errno(err)
+		}
+
+		if secret != nil && len(secret.Data) > 0 {
+			return errNotEmpty
+		}
+	}
+
+	if !req.Dir {
+		secret, err := d.root.read(ctx, p)
+		if err != nil {
+			logger.WithError(err).Error("error reading key")
+			return errno(err)
+		}
+
+		if secret == nil {
+			// virtual names like db.json are views of another secret
+			node, err := d.lookupFormat(ctx, req.Name)
+			if err != nil {
+				logger.WithError(err).Error("error reading key")
+				return errno(err)
+			}
+
+			if node != nil {
+				return fuse.EPERM
+			}
+			return fuse.ENOENT
+		}
+	}
+
+	if err := d.root.delete(ctx, p); err != nil {
+		logger.WithError(err).Error("error deleting key")
+		return errno(err)
+	}
+
+	return nil
+}
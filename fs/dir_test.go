@@ -0,0 +1,250 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+var dirSecrets = map[string]map[string]interface{}{
+	"secret/db":           {"password": "hunter2"},
+	"secret/team/app":     {"value": "app"},
+	"secret/team/app/env": {"value": "env"},
+	"secret/team/web":     {"value": "web"},
+	"other/x":             {"value": "x"},
+}
+
+func TestDirReadDirAll(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		path   string
+		want   []string
+	}{
+		{"root", LayoutSecret, "secret", []string{"db", "team/"}},
+		{"nested", LayoutSecret, "secret/team", []string{"app", "web"}},
+		{"fields root", LayoutFields, "secret", []string{"db/", "team/"}},
+		{"fields nested", LayoutFields, "secret/team", []string{"app/", "web/"}},
+		{"missing", LayoutSecret, "secret/missing", []string{}},
+	}
+
+	for _, tt := range tests {
+		root, _ := newTestRoot(t, Options{Layout: tt.layout}, dirSecrets)
+
+		dirs, err := NewDir(root, tt.path, 0).ReadDirAll(context.Background())
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if got := names(dirs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDirReadDirAllEmptyRoot(t *testing.T) {
+	backend := NewMemory()
+	for p, data := range dirSecrets {
+		backend.Write(context.Background(), p, data)
+	}
+
+	root := NewRoot("", backend, Options{Layout: LayoutSecret, Write: WriteNone})
+	dirs, err := root.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := names(dirs), []string{"other/", "secret/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDirLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		path   string
+		lookup string
+		want   interface{}
+		format Format
+		err    error
+	}{
+		{"secret", LayoutSecret, "secret", "db", &Secret{}, FormatSecret, nil},
+		{"prefix", LayoutSecret, "secret", "team", &Dir{}, "", nil},
+		{"extension", LayoutSecret, "secret", "db.yaml", &Secret{}, FormatYAML, nil},
+		{"extension of missing", LayoutSecret, "secret", "missing.json", nil, "", fuse.ENOENT},
+		{"missing", LayoutSecret, "secret", "missing", nil, "", fuse.ENOENT},
+		{"secret shadows prefix", LayoutSecret, "secret/team", "app", &Secret{}, FormatSecret, nil},
+		{"fields", LayoutFields, "secret", "db", &Fields{}, "", nil},
+		{"no extensions in fields", LayoutFields, "secret", "db.json", nil, "", fuse.ENOENT},
+		{"no versions in memory", LayoutSecret, "secret", versionsDir, nil, "", fuse.ENOENT},
+	}
+
+	for _, tt := range tests {
+		root, _ := newTestRoot(t, Options{Layout: tt.layout}, dirSecrets)
+
+		node, err := NewDir(root, tt.path, 0).Lookup(context.Background(), tt.lookup)
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+
+		if tt.want == nil {
+			continue
+		}
+
+		if reflect.TypeOf(node) != reflect.TypeOf(tt.want) {
+			t.Errorf("%s: got %T, want %T", tt.name, node, tt.want)
+			continue
+		}
+
+		if secret, ok := node.(*Secret); ok && secret.format != tt.format {
+			t.Errorf("%s: got format %q, want %q", tt.name, secret.format, tt.format)
+		}
+	}
+}
+
+func TestDirLookupFormatReadOnly(t *testing.T) {
+	root, backend := newTestRoot(t, Options{Write: WriteValue}, dirSecrets)
+	ctx := context.Background()
+
+	node, err := NewDir(root, "secret", 0).Lookup(ctx, "db.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := node.(*Secret)
+
+	var attr fuse.Attr
+	if err := secret.Attr(ctx, &attr); err != nil {
+		t.Fatal(err)
+	}
+	if attr.Mode != 0444 {
+		t.Errorf("got mode %v, want %v", attr.Mode, os.FileMode(0444))
+	}
+
+	for _, flags := range []fuse.OpenFlags{fuse.OpenWriteOnly | fuse.OpenTruncate, fuse.OpenReadWrite} {
+		if _, err := secret.Open(ctx, &fuse.OpenRequest{Flags: flags}, &fuse.OpenResponse{}); err != errReadOnly {
+			t.Errorf("opening with %v: got error %v, want %v", flags, err, errReadOnly)
+		}
+	}
+
+	req := &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: 0}
+	if err := secret.Setattr(ctx, req, &fuse.SetattrResponse{}); err != errReadOnly {
+		t.Errorf("truncating: got error %v, want %v", err, errReadOnly)
+	}
+
+	if _, err := secret.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadOnly}, &fuse.OpenResponse{}); err != nil {
+		t.Errorf("opening for reading: %s", err)
+	}
+
+	if stored, _ := backend.Read(ctx, "secret/db"); !reflect.DeepEqual(stored.Data, dirSecrets["secret/db"]) {
+		t.Errorf("secret changed to %v", stored.Data)
+	}
+}
+
+func TestDirRemove(t *testing.T) {
+	tests := []struct {
+		name        string
+		layout      Layout
+		allowDelete bool
+		path        string
+		remove      string
+		dir         bool
+		err         error
+		gone        string
+		kept        string
+	}{
+		{"not allowed", LayoutSecret, false, "secret", "db", false, fuse.EPERM, "", "secret/db"},
+		{"secret", LayoutSecret, true, "secret", "db", false, nil, "secret/db", ""},
+		{"virtual name", LayoutSecret, true, "secret", "db.json", false, fuse.EPERM, "", "secret/db"},
+		{"missing", LayoutSecret, true, "secret", "missing", false, fuse.ENOENT, "", ""},
+		{"non-empty prefix", LayoutSecret, true, "secret", "team", true, errNotEmpty, "", "secret/team/web"},
+		{"empty prefix", LayoutSecret, true, "secret", "empty", true, nil, "", ""},
+		{"fields secret", LayoutFields, true, "secret/team", "web", true, errNotEmpty, "", "secret/team/web"},
+	}
+
+	for _, tt := range tests {
+		root, backend := newTestRoot(t, Options{Layout: tt.layout, AllowDelete: tt.allowDelete}, dirSecrets)
+
+		err := NewDir(root, tt.path, 0).Remove(context.Background(), &fuse.RemoveRequest{Name: tt.remove, Dir: tt.dir})
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		}
+
+		if tt.gone != "" {
+			if secret, _ := backend.Read(context.Background(), tt.gone); secret != nil {
+				t.Errorf("%s: %s was not deleted", tt.name, tt.gone)
+			}
+		}
+
+		if tt.kept != "" {
+			if secret, _ := backend.Read(context.Background(), tt.kept); secret == nil {
+				t.Errorf("%s: %s was deleted", tt.name, tt.kept)
+			}
+		}
+	}
+}
+
+func TestDirCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		write  WriteMode
+		err    error
+	}{
+		{"read-only", LayoutSecret, WriteNone, errReadOnly},
+		{"fields", LayoutFields, WriteValue, fuse.EPERM},
+		{"value", LayoutSecret, WriteValue, nil},
+	}
+
+	for _, tt := range tests {
+		root, backend := newTestRoot(t, Options{Layout: tt.layout, Write: tt.write}, dirSecrets)
+
+		_, handle, err := NewDir(root, "secret", 0).Create(context.Background(), &fuse.CreateRequest{Name: "new"}, &fuse.CreateResponse{})
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		write(t, handle.(*Handle), 0, "created")
+		secret, _ := backend.Read(context.Background(), "secret/new")
+		if secret == nil || secret.Data["value"] != "created" {
+			t.Errorf("%s: got %v, want a secret with the written value", tt.name, secret)
+		}
+	}
+}
+
+// write writes to a handle at the given offset and flushes it
+func write(t *testing.T, h *Handle, offset int64, data string) {
+	ctx := context.Background()
+
+	if err := h.Write(ctx, &fuse.WriteRequest{Offset: offset, Data: []byte(data)}, &fuse.WriteResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Flush(ctx, &fuse.FlushRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
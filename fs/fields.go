@@ -0,0 +1,300 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// Fields implements both Node and Handle for a secret laid out as a directory
+// of its data fields
+type Fields struct {
+	*api.Secret
+	root  *Root
+	path  string
+	inode uint64
+
+	m sync.Mutex
+}
+
+// NewFields creates a new directory of fields for the given secret
+func NewFields(root *Root, path string, secret *api.Secret, inode uint64) *Fields {
+	return &Fields{
+		Secret: secret,
+		root:   root,
+		path:   path,
+		inode:  inode,
+	}
+}
+
+// Attr sets attrs on the given fuse.Attr
+func (f *Fields) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = f.inode
+	a.Mode = os.ModeDir | f.root.dirMode()
+
+	if err := f.root.times(ctx, f.path, a); err != nil {
+		logrus.WithError(err).WithField("path", f.path).Error("error reading metadata")
+		return errno(err)
+	}
+
+	return nil
+}
+
+// Lookup looks up a field. A secret can also be a prefix in Vault, so names
+// that are not fields may be secrets or prefixes under it.
+func (f *Fields) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	logger := logrus.WithFields(logrus.Fields{"path": f.path, "name": name})
+	logger.Debug("handling Fields.Lookup call")
+
+	if _, ok := f.get(name); ok {
+		return f.field(name), nil
+	}
+
+	keys, err := f.root.list(ctx, f.path)
+	if err != nil {
+		logger.WithError(err).Error("error listing prefix")
+		return nil, errno(err)
+	}
+
+	for _, key := range keys {
+		if strings.TrimSuffix(key, "/") == name {
+			return NewDir(f.root, f.path, f.root.inodes.get(f.path+"/")).Lookup(ctx, name)
+		}
+	}
+
+	if name == versionsDir {
+		return f.root.versions(ctx, f.path)
+	}
+
+	return nil, fuse.ENOENT
+}
+
+// ReadDirAll returns a list of fields, followed by the secrets and prefixes
+// under the secret that do not have the same name as a field
+func (f *Fields) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	logrus.WithField("path", f.path).Debug("handling Fields.ReadDirAll call")
+
+	nested, err := NewDir(f.root, f.path, f.root.inodes.get(f.path+"/")).ReadDirAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	dirs := []fuse.Dirent{}
+	for name := range f.Data {
+		// not representable as a file name
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+
+		dirs = append(dirs, fuse.Dirent{
+			Name:  name,
+			Inode: f.root.inodes.get(path.Join(f.path, name)),
+			Type:  fuse.DT_File,
+		})
+	}
+
+	for _, ent := range nested {
+		if _, ok := f.Data[ent.Name]; !ok {
+			dirs = append(dirs, ent)
+		}
+	}
+
+	return dirs, nil
+}
+
+// Create adds a new field, which is stored when it is first flushed
+func (f *Fields) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	logrus.WithFields(logrus.Fields{"path": f.path, "name": req.Name}).Debug("handling Fields.Create call")
+
+	if f.root.opts.Write == WriteNone {
+		return nil, nil, errReadOnly
+	}
+
+	field := f.field(req.Name)
+	resp.Flags |= fuse.OpenDirectIO
+	return field, field.open(nil, field.commit), nil
+}
+
+// Remove deletes a field. The secret is deleted along with its last field.
+func (f *Fields) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	logger := logrus.WithFields(logrus.Fields{"path": f.path, "name": req.Name})
+	logger.Debug("handling Fields.Remove call")
+
+	if !f.root.opts.AllowDelete {
+		return fuse.EPERM
+	}
+
+	if _, ok := f.get(req.Name); !ok {
+		if req.Dir {
+			return NewDir(f.root, f.path, f.root.inodes.get(f.path+"/")).Remove(ctx, req)
+		}
+		return fuse.ENOENT
+	}
+
+	if err := f.unset(ctx, req.Name); err != nil {
+		logger.WithError(err).Error("error deleting field")
+		return errno(err)
+	}
+
+	return nil
+}
+
+func (f *Fields) field(name string) *Field {
+	return &Field{
+		parent: f,
+		name:   name,
+		inode:  f.root.inodes.get(path.Join(f.path, name)),
+	}
+}
+
+func (f *Fields) get(name string) (interface{}, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	value, ok := f.Data[name]
+	return value, ok
+}
+
+// set stores a single field, keeping the others as they are
+func (f *Fields) set(ctx context.Context, name string, value interface{}) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	data := copyData(f.Data)
+	data[name] = value
+
+	logrus.WithFields(logrus.Fields{"path": f.path, "field": name}).Debug("writing field")
+	if err := f.root.write(ctx, f.path, data); err != nil {
+		return err
+	}
+
+	updated := *f.Secret
+	updated.Data = data
+	f.Secret = &updated
+
+	return nil
+}
+
+// unset removes a single field, deleting the secret if no fields remain
+func (f *Fields) unset(ctx context.Context, name string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	data := copyData(f.Data)
+	delete(data, name)
+
+	if len(data) == 0 {
+		logrus.WithField("path", f.path).Debug("deleting secret")
+		if err := f.root.delete(ctx, f.path); err != nil {
+			return err
+		}
+	} else {
+		logrus.WithFields(logrus.Fields{"path": f.path, "field": name}).Debug("deleting field")
+		if err := f.root.write(ctx, f.path, data); err != nil {
+			return err
+		}
+	}
+
+	updated := *f.Secret
+	updated.Data = data
+	f.Secret = &updated
+
+	return nil
+}
+
+// Field implements Node and Handle for a single value of a secret
+type Field struct {
+	parent *Fields
+	name   string
+	inode  uint64
+
+	writers
+}
+
+// Attr returns attributes about this Field
+func (f *Field) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = f.inode
+	a.Mode = f.parent.root.fileMode()
+
+	content, err := f.ReadAll(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("could not determine content length")
+		return fuse.EIO
+	}
+
+	a.Size = uint64(len(content))
+	return nil
+}
+
+// ReadAll gets the content of this Field. Strings are returned as-is, other
+// values are encoded as JSON.
+func (f *Field) ReadAll(ctx context.Context) ([]byte, error) {
+	value, ok := f.parent.get(f.name)
+	if !ok {
+		return []byte{}, nil
+	}
+
+	return fieldBytes(value)
+}
+
+// Open opens this Field for reading, or for writing if enabled
+func (f *Field) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if req.Flags.IsReadOnly() {
+		return f, nil
+	}
+
+	if f.parent.root.opts.Write == WriteNone {
+		return nil, errReadOnly
+	}
+
+	var content []byte
+	if req.Flags&fuse.OpenTruncate == 0 {
+		var err error
+		if content, err = f.ReadAll(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp.Flags |= fuse.OpenDirectIO
+	return f.open(append([]byte{}, content...), f.commit), nil
+}
+
+// Setattr handles truncation of open handles
+func (f *Field) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		if f.parent.root.opts.Write == WriteNone {
+			return errReadOnly
+		}
+		f.truncate(req.Size)
+	}
+
+	return f.Attr(ctx, &resp.Attr)
+}
+
+func (f *Field) commit(ctx context.Context, content []byte) error {
+	return f.parent.set(ctx, f.name, string(content))
+}
@@ -0,0 +1,166 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+var fieldsSecrets = map[string]map[string]interface{}{
+	"secret/team/app":         {"user": "admin", "port": 8080, "env": "shadowed"},
+	"secret/team/app/env/db":  {"value": "db"},
+	"secret/team/app/tls/crt": {"value": "crt"},
+	"secret/team/app/key":     {"value": "key"},
+}
+
+// lookupFields looks up the secret at secret/team/app in the fields layout
+func lookupFields(t *testing.T, opts Options) (*Fields, *Memory) {
+	opts.Layout = LayoutFields
+	root, backend := newTestRoot(t, opts, fieldsSecrets)
+
+	node, err := NewDir(root, "secret/team", 0).Lookup(context.Background(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return node.(*Fields), backend
+}
+
+func TestFieldsReadDirAll(t *testing.T) {
+	fields, _ := lookupFields(t, Options{})
+
+	dirs, err := fields.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"env", "key/", "port", "tls/", "user"}
+	if got := names(dirs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFieldsLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want interface{}
+		read string
+		err  error
+	}{
+		{"user", &Field{}, "admin", nil},
+		{"port", &Field{}, "8080", nil},
+		{"env", &Field{}, "shadowed", nil},
+		{"tls", &Dir{}, "", nil},
+		{"key", &Fields{}, "", nil},
+		{"missing", nil, "", fuse.ENOENT},
+		{versionsDir, nil, "", fuse.ENOENT},
+	}
+
+	fields, _ := lookupFields(t, Options{})
+	for _, tt := range tests {
+		node, err := fields.Lookup(context.Background(), tt.name)
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+
+		if tt.want == nil {
+			continue
+		}
+
+		if reflect.TypeOf(node) != reflect.TypeOf(tt.want) {
+			t.Errorf("%s: got %T, want %T", tt.name, node, tt.want)
+			continue
+		}
+
+		if field, ok := node.(*Field); ok {
+			content, _ := field.ReadAll(context.Background())
+			if string(content) != tt.read {
+				t.Errorf("%s: got %q, want %q", tt.name, content, tt.read)
+			}
+		}
+	}
+}
+
+func TestFieldWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  string
+		flags  fuse.OpenFlags
+		offset int64
+		data   string
+		want   interface{}
+	}{
+		{"append", "user", fuse.OpenWriteOnly | fuse.OpenAppend, 5, "s", "admins"},
+		{"truncate", "user", fuse.OpenWriteOnly | fuse.OpenTruncate, 0, "root", "root"},
+		{"new", "new", fuse.OpenWriteOnly, 0, "value", "value"},
+	}
+
+	for _, tt := range tests {
+		fields, backend := lookupFields(t, Options{Write: WriteValue})
+
+		handle, err := fields.field(tt.field).Open(context.Background(), &fuse.OpenRequest{Flags: tt.flags}, &fuse.OpenResponse{})
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		write(t, handle.(*Handle), tt.offset, tt.data)
+
+		secret, _ := backend.Read(context.Background(), "secret/team/app")
+		if secret.Data[tt.field] != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, secret.Data[tt.field], tt.want)
+		}
+		if secret.Data["port"] != 8080 {
+			t.Errorf("%s: other fields were not kept: %v", tt.name, secret.Data)
+		}
+	}
+}
+
+func TestFieldsRemove(t *testing.T) {
+	fields, backend := lookupFields(t, Options{AllowDelete: true})
+	ctx := context.Background()
+
+	for _, name := range []string{"user", "port"} {
+		if err := fields.Remove(ctx, &fuse.RemoveRequest{Name: name}); err != nil {
+			t.Fatalf("removing %s: %s", name, err)
+		}
+	}
+
+	secret, _ := backend.Read(ctx, "secret/team/app")
+	if want := map[string]interface{}{"env": "shadowed"}; secret == nil || !reflect.DeepEqual(secret.Data, want) {
+		t.Fatalf("got %v, want %v", secret, want)
+	}
+
+	if err := fields.Remove(ctx, &fuse.RemoveRequest{Name: "missing"}); err != fuse.ENOENT {
+		t.Errorf("removing a missing field: got error %v, want %v", err, fuse.ENOENT)
+	}
+
+	if err := fields.Remove(ctx, &fuse.RemoveRequest{Name: "tls", Dir: true}); err != errNotEmpty {
+		t.Errorf("removing a nested prefix: got error %v, want %v", err, errNotEmpty)
+	}
+
+	if err := fields.Remove(ctx, &fuse.RemoveRequest{Name: "env"}); err != nil {
+		t.Fatalf("removing the last field: %s", err)
+	}
+
+	if secret, _ := backend.Read(ctx, "secret/team/app"); secret != nil {
+		t.Errorf("secret was not deleted with its last field: %v", secret)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"gopkg.in/yaml.v2"
+)
+
+// Format controls how a secret file is rendered
+type Format string
+
+const (
+	// FormatSecret renders the full Vault response as JSON
+	FormatSecret Format = "secret"
+
+	// FormatJSON renders the secret's data as JSON
+	FormatJSON Format = "json"
+
+	// FormatYAML renders the secret's data as YAML
+	FormatYAML Format = "yaml"
+
+	// FormatEnv renders the secret's data as dotenv KEY=value lines
+	FormatEnv Format = "env"
+
+	// FormatProperties renders the secret's data as a Java properties file
+	FormatProperties Format = "properties"
+
+	// FormatRaw renders the secret's single value as-is
+	FormatRaw Format = "raw"
+)
+
+// Formats lists all valid formats
+var Formats = []Format{FormatSecret, FormatJSON, FormatYAML, FormatEnv, FormatProperties, FormatRaw}
+
+// extensions maps the extensions of virtual file names to the format they
+// select
+var extensions = map[string]Format{
+	".json":       FormatJSON,
+	".yaml":       FormatYAML,
+	".yml":        FormatYAML,
+	".env":        FormatEnv,
+	".properties": FormatProperties,
+}
+
+var (
+	// envKey matches the names a shell accepts for variables
+	envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// envLiteral matches values a shell reads literally without quotes
+	envLiteral = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+)
+
+// ParseFormat returns the named format, or an error if it is unknown
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if Format(name) == format {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid format %q, expected one of secret, json, yaml, env, properties, or raw", name)
+}
+
+// Render renders the given secret in this format
+func (f Format) Render(secret *api.Secret) ([]byte, error) {
+	switch f {
+	case FormatSecret, "":
+		return json.Marshal(secret)
+
+	case FormatJSON:
+		return json.Marshal(secret.Data)
+
+	case FormatYAML:
+		return yaml.Marshal(secret.Data)
+
+	case FormatEnv:
+		return renderLines(envData(secret.Data), "=", escapeEnv)
+
+	case FormatProperties:
+		return renderLines(secret.Data, "=", escapeProperty)
+
+	case FormatRaw:
+		value, ok := secret.Data["value"]
+		if !ok && len(secret.Data) == 1 {
+			for _, v := range secret.Data {
+				value, ok = v, true
+			}
+		}
+		if !ok {
+			return nil, errors.New("raw format needs a secret with a single field or a value field")
+		}
+
+		return fieldBytes(value)
+	}
+
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+// fieldBytes returns a single value of a secret. Strings are returned as-is,
+// other values are encoded as JSON.
+func fieldBytes(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+
+	return json.Marshal(value)
+}
+
+// renderLines renders data as sorted key/value lines, escaping keys and values
+// with the given function
+func renderLines(data map[string]interface{}, sep string, escape func(s string, key bool) string) ([]byte, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		value, err := fieldBytes(data[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteString(escape(key, true))
+		buf.WriteString(sep)
+		buf.WriteString(escape(string(value), false))
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// envData returns the fields of a secret that can be environment variables.
+// Other fields are skipped, since their names could not be sourced safely.
+func envData(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if !envKey.MatchString(key) {
+			logrus.WithField("key", key).Warn("skipping field that is not a valid environment variable name")
+			continue
+		}
+		out[key] = value
+	}
+
+	return out
+}
+
+// escapeEnv quotes a value so that a shell reads it literally when the file
+// is sourced. Keys are checked by envData instead.
+func escapeEnv(s string, key bool) string {
+	if key || envLiteral.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// escapeProperty escapes a key or value for a Java properties file
+func escapeProperty(s string, key bool) string {
+	var buf bytes.Buffer
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			buf.WriteString(`\ `)
+		case (r == '=' || r == ':') && key:
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		case (r == '#' || r == '!') && key && i == 0:
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			if r > 0xffff {
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(&buf, `\u%04x\u%04x`, r1, r2)
+			} else {
+				fmt.Fprintf(&buf, `\u%04x`, r)
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String()
+}
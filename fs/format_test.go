@@ -0,0 +1,119 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestRenderEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"plain", map[string]interface{}{"A": "b", "URL": "https://host:8200/v1"}, "A=b\nURL=https://host:8200/v1\n"},
+		{"empty", map[string]interface{}{"A": ""}, "A=\n"},
+		{"space", map[string]interface{}{"A": "b c"}, "A='b c'\n"},
+		{"command substitution", map[string]interface{}{"L": "`id`", "M": "$(id)"}, "L='`id`'\nM='$(id)'\n"},
+		{"operators", map[string]interface{}{"A": "a;b|c&d(e)<f>g"}, "A='a;b|c&d(e)<f>g'\n"},
+		{"quote", map[string]interface{}{"A": "it's"}, "A='it'\\''s'\n"},
+		{"newline", map[string]interface{}{"A": "a\nb"}, "A='a\nb'\n"},
+		{"tilde", map[string]interface{}{"A": "~/x"}, "A='~/x'\n"},
+		{"number", map[string]interface{}{"A": 8080}, "A=8080\n"},
+		{"invalid keys", map[string]interface{}{"bad key": "v", "1A": "v", "a-b": "v", "_ok": "v"}, "_ok=v\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := FormatEnv.Render(&api.Secret{Data: tt.data})
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if string(out) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, out, tt.want)
+		}
+	}
+}
+
+func TestRenderEnvSource(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to source the file with")
+	}
+
+	values := []string{"b c", "`id`", "$(id)", "$HOME", "it's", `a\b"c`, "a;b|c&d", "line\nbreak", "~/x", "*"}
+
+	for _, value := range values {
+		out, err := FormatEnv.Render(&api.Secret{Data: map[string]interface{}{"V": value}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := ioutil.TempFile("", "vaultfs-env")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(out)
+		file.Close()
+
+		got, err := exec.Command(sh, "-c", `. "$0" && printf %s "$V"`, file.Name()).Output()
+		os.Remove(file.Name())
+		if err != nil {
+			t.Errorf("sourcing %q: %s", out, err)
+			continue
+		}
+
+		if string(got) != value {
+			t.Errorf("sourcing %q: got %q, want %q", out, got, value)
+		}
+	}
+}
+
+func TestEscapeProperty(t *testing.T) {
+	tests := []struct {
+		in   string
+		key  bool
+		want string
+	}{
+		{"plain", false, "plain"},
+		{"a b", false, "a b"},
+		{" leading", false, `\ leading`},
+		{"a b", true, `a\ b`},
+		{"a=b:c", true, `a\=b\:c`},
+		{"a=b:c", false, "a=b:c"},
+		{"#comment", true, `\#comment`},
+		{"!bang", true, `\!bang`},
+		{"a#b", true, "a#b"},
+		{"#value", false, "#value"},
+		{`back\slash`, false, `back\\slash`},
+		{"tab\tnew\nret\rfeed\f", false, `tab\tnew\nret\rfeed\f`},
+		{"caf\u00e9", false, `caf\u00e9`},
+		{"\U0001F600", false, `\ud83d\ude00`},
+		{"\x01", false, `\u0001`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeProperty(tt.in, tt.key); got != tt.want {
+			t.Errorf("escapeProperty(%q, %v) = %q, want %q", tt.in, tt.key, got, tt.want)
+		}
+	}
+}
@@ -16,34 +16,146 @@ package fs
 
 import (
 	"errors"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
 )
 
+// Layout controls how secrets are presented in the filesystem
+type Layout string
+
+const (
+	// LayoutSecret exposes each secret as a single JSON file
+	LayoutSecret Layout = "secret"
+
+	// LayoutFields exposes each secret as a directory with one file per field
+	LayoutFields Layout = "fields"
+)
+
+// WriteMode controls how content written to a secret file is stored
+type WriteMode string
+
+const (
+	// WriteNone makes the filesystem read-only
+	WriteNone WriteMode = "none"
+
+	// WriteJSON stores content as a JSON object of the secret's data
+	WriteJSON WriteMode = "json"
+
+	// WriteValue stores content as the "value" field of the secret
+	WriteValue WriteMode = "value"
+)
+
+var (
+	// errReadOnly is returned for modifications when writes are disabled
+	errReadOnly = fuse.Errno(syscall.EROFS)
+
+	// errNotEmpty is returned when removing a directory with entries
+	errNotEmpty = fuse.Errno(syscall.ENOTEMPTY)
+
+	// errTimedOut is returned when a request to Vault takes too long
+	errTimedOut = fuse.Errno(syscall.ETIMEDOUT)
+)
+
+// errno converts an error from Vault into the error returned to the kernel
+func errno(err error) error {
+	switch err {
+	case context.Canceled:
+		return fuse.EINTR
+	case context.DeadlineExceeded:
+		return errTimedOut
+	}
+
+	if _, ok := err.(fuse.ErrorNumber); ok {
+		return err
+	}
+
+	return fuse.EIO
+}
+
+// Options configures the presentation of a VaultFS
+type Options struct {
+	Layout      Layout
+	Format      Format
+	Write       WriteMode
+	AllowDelete bool
+
+	// Templates are rendered in the _templates directory, if set
+	Templates *Templates
+
+	// CacheTTL is the longest time a response from Vault is reused. Caching
+	// is disabled if it is zero.
+	CacheTTL time.Duration
+
+	// Timeout bounds detecting the key/value engine when the root is first
+	// read, if set. Other requests are bounded by the timeout of the config's
+	// HTTP client, which may be shared by several filesystems.
+	Timeout time.Duration
+
+	// KVVersion is the version of the key/value secrets engine holding the
+	// root, or zero to detect it
+	KVVersion int
+
+	// Auth logs in to get a token, instead of using the given token, if set
+	Auth Authenticator
+
+	// TokenFile is read for the token, instead of using the given token, and
+	// read again whenever it changes, if set
+	TokenFile string
+}
+
 // VaultFS is a vault filesystem
 type VaultFS struct {
 	*api.Client
+	config     *api.Config
 	root       string
 	conn       *fuse.Conn
 	mountpoint string
+	opts       Options
+	tokens     *tokenManager
 }
 
 // New returns a new VaultFS
-func New(config *api.Config, mountpoint, token, root string) (*VaultFS, error) {
+func New(config *api.Config, mountpoint, token, root string, opts Options) (*VaultFS, error) {
 	client, err := api.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
+	if opts.TokenFile != "" && opts.Auth == nil {
+		if token, err = readToken(opts.TokenFile); err != nil {
+			return nil, err
+		}
+	}
 	client.SetToken(token)
 
-	return &VaultFS{
+	v := &VaultFS{
 		Client:     client,
-		root:       root,
+		config:     config,
+		root:       cleanPath(root),
 		mountpoint: mountpoint,
-	}, nil
+		opts:       opts,
+		tokens:     newTokenManager(config, token, opts.Auth),
+	}
+
+	var auth *api.SecretAuth
+	if opts.Auth != nil {
+		if auth, err = v.tokens.login(); err != nil {
+			return nil, err
+		}
+	} else if opts.TokenFile != "" {
+		if err := v.tokens.watch(opts.TokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	go v.tokens.run(auth)
+
+	return v, nil
 }
 
 // Mount the FS at the given mountpoint
@@ -66,6 +178,10 @@ func (v *VaultFS) Mount() error {
 
 // Unmount the FS
 func (v *VaultFS) Unmount() error {
+	// stop renewing the token first, so that a failed unmount does not leave
+	// the renewal and the token file watcher running
+	v.tokens.close()
+
 	if v.conn == nil {
 		return errors.New("not mounted")
 	}
@@ -92,5 +208,12 @@ func (v *VaultFS) Unmount() error {
 // Root returns the struct that does the actual work
 func (v *VaultFS) Root() (fs.Node, error) {
 	logrus.Debug("returning root")
-	return NewRoot(v.root, v.Logical()), nil
+	ctx, cancel := context.Background(), func() {}
+	if v.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, v.opts.Timeout)
+	}
+	defer cancel()
+
+	vault := NewVault(v.Client, v.config.HttpClient, v.tokens.Token)
+	return NewRoot(v.root, newBackend(ctx, vault, v.root, v.opts.KVVersion), v.opts), nil
 }
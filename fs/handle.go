@@ -0,0 +1,139 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"sync"
+
+	"bazil.org/fuse"
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Handle buffers the content of a file opened for writing and stores it in
+// Vault when the file is flushed
+type Handle struct {
+	m       sync.Mutex
+	buf     []byte
+	dirty   bool
+	commit  func(context.Context, []byte) error
+	writers *writers
+}
+
+// Write writes data at the requested offset, growing the buffer as needed
+func (h *Handle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	end := int(req.Offset) + len(req.Data)
+	if end > len(h.buf) {
+		buf := make([]byte, end)
+		copy(buf, h.buf)
+		h.buf = buf
+	}
+
+	copy(h.buf[req.Offset:], req.Data)
+	h.dirty = true
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// ReadAll returns the buffered content
+func (h *Handle) ReadAll(ctx context.Context) ([]byte, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return append([]byte{}, h.buf...), nil
+}
+
+// Flush stores the buffered content if it has changed
+func (h *Handle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if !h.dirty {
+		return nil
+	}
+
+	if err := h.commit(ctx, h.buf); err != nil {
+		logrus.WithError(err).Error("error writing secret")
+		return errno(err)
+	}
+	h.dirty = false
+
+	return nil
+}
+
+// Release stores any remaining changes and forgets the handle
+func (h *Handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.writers.remove(h)
+	return h.Flush(ctx, nil)
+}
+
+func (h *Handle) truncate(size uint64) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if int(size) < len(h.buf) {
+		h.buf = h.buf[:size]
+	} else {
+		h.buf = append(h.buf, make([]byte, int(size)-len(h.buf))...)
+	}
+	h.dirty = true
+}
+
+// writers tracks the open write handles of a node. The kernel truncates files
+// opened with O_TRUNC through a separate setattr call on the node, so the node
+// has to be able to reach its handles.
+type writers struct {
+	m       sync.Mutex
+	handles map[*Handle]bool
+}
+
+// open creates and tracks a new write handle with the given initial content
+func (w *writers) open(content []byte, commit func(context.Context, []byte) error) *Handle {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	h := &Handle{
+		buf:     content,
+		commit:  commit,
+		writers: w,
+	}
+
+	if w.handles == nil {
+		w.handles = map[*Handle]bool{}
+	}
+	w.handles[h] = true
+
+	return h
+}
+
+func (w *writers) remove(h *Handle) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	delete(w.handles, h)
+}
+
+func (w *writers) truncate(size uint64) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	for h := range w.handles {
+		h.truncate(size)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import "sync"
+
+// rootInode is the inode of the root of the filesystem
+const rootInode = 1
+
+// inodes allocates inode numbers by full Vault path, so a path keeps its inode
+// for the lifetime of the mount and no two paths share one. Prefixes are
+// keyed with a trailing slash, since a secret and a prefix may have the same
+// name.
+type inodes struct {
+	m     sync.Mutex
+	next  uint64
+	paths map[string]uint64
+}
+
+func newInodes() *inodes {
+	return &inodes{
+		next:  rootInode + 1,
+		paths: map[string]uint64{},
+	}
+}
+
+// get returns the inode for the given key, allocating a new one if needed
+func (i *inodes) get(key string) uint64 {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if inode, ok := i.paths[key]; ok {
+		return inode
+	}
+
+	inode := i.next
+	i.next++
+	i.paths[key] = inode
+
+	return inode
+}
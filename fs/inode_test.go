@@ -0,0 +1,38 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import "testing"
+
+func TestInodes(t *testing.T) {
+	i := newInodes()
+
+	tests := []struct {
+		key  string
+		want uint64
+	}{
+		{"secret/a", rootInode + 1},
+		{"secret/a/", rootInode + 2},
+		{"secret/b", rootInode + 3},
+		{"secret/a", rootInode + 1},
+		{"secret/a/", rootInode + 2},
+	}
+
+	for _, tt := range tests {
+		if got := i.get(tt.key); got != tt.want {
+			t.Errorf("get(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// KV2 is a Backend for version 2 of the key/value secrets engine. It
+// translates paths to the data and metadata endpoints of the mount and
+// unwraps the nested payload, so the filesystem sees the same paths and data
+// as with version 1. Paths outside the mount, like those read by templates,
+// are passed to Vault as they are.
+type KV2 struct {
+	vault *Vault
+	mount string
+}
+
+// NewKV2 creates a new KV2 backend for the engine mounted at the given path
+func NewKV2(vault *Vault, mount string) *KV2 {
+	return &KV2{
+		vault: vault,
+		mount: strings.Trim(mount, "/") + "/",
+	}
+}
+
+// Read reads the latest version of a secret, which is nil if it has been
+// deleted
+func (k *KV2) Read(ctx context.Context, p string) (*api.Secret, error) {
+	if !k.contains(p) {
+		return k.vault.Read(ctx, p)
+	}
+
+	secret, err := k.vault.Read(ctx, k.path("data", p))
+	if err != nil || secret == nil {
+		return nil, err
+	}
+
+	return unwrapKV2(secret), nil
+}
+
+// List lists a prefix through the metadata endpoint
+func (k *KV2) List(ctx context.Context, prefix string) ([]string, error) {
+	if !k.contains(prefix) {
+		return k.vault.List(ctx, prefix)
+	}
+
+	return k.vault.List(ctx, k.path("metadata", prefix))
+}
+
+// Write writes a new version of a secret
+func (k *KV2) Write(ctx context.Context, p string, data map[string]interface{}) error {
+	if !k.contains(p) {
+		return k.vault.Write(ctx, p, data)
+	}
+
+	return k.vault.Write(ctx, k.path("data", p), map[string]interface{}{"data": data})
+}
+
+// Delete deletes the latest version of a secret. Earlier versions are kept.
+func (k *KV2) Delete(ctx context.Context, p string) error {
+	if !k.contains(p) {
+		return k.vault.Delete(ctx, p)
+	}
+
+	return k.vault.Delete(ctx, k.path("data", p))
+}
+
+// Metadata reads the creation and update times and the versions of a secret
+func (k *KV2) Metadata(ctx context.Context, p string) (*Metadata, error) {
+	if !k.contains(p) {
+		return k.vault.Metadata(ctx, p)
+	}
+
+	secret, err := k.vault.Read(ctx, k.path("metadata", p))
+	if err != nil || secret == nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{
+		Created: parseTime(secret.Data["created_time"]),
+		Updated: parseTime(secret.Data["updated_time"]),
+	}
+
+	versions, _ := secret.Data["versions"].(map[string]interface{})
+	for key, raw := range versions {
+		number, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+
+		info, _ := raw.(map[string]interface{})
+		destroyed, _ := info["destroyed"].(bool)
+		metadata.Versions = append(metadata.Versions, Version{
+			Number:    number,
+			Created:   parseTime(info["created_time"]),
+			Deleted:   parseTime(info["deletion_time"]),
+			Destroyed: destroyed,
+		})
+	}
+	sort.Sort(byNumber(metadata.Versions))
+
+	return metadata, nil
+}
+
+// ReadVersion reads the given version of a secret, which is nil if it has
+// been deleted or destroyed
+func (k *KV2) ReadVersion(ctx context.Context, p string, version int) (*api.Secret, error) {
+	if !k.contains(p) {
+		return nil, nil
+	}
+
+	params := url.Values{"version": []string{strconv.Itoa(version)}}
+
+	secret, err := k.vault.readParams(ctx, k.path("data", p), params)
+	if err != nil || secret == nil {
+		return nil, err
+	}
+
+	return unwrapKV2(secret), nil
+}
+
+// contains checks whether the given path is in the mount
+func (k *KV2) contains(p string) bool {
+	return strings.HasPrefix(cleanPath(p)+"/", k.mount)
+}
+
+// path translates a path in the filesystem to a path under the given
+// endpoint of the mount
+func (k *KV2) path(endpoint, p string) string {
+	rel := strings.TrimPrefix(strings.Trim(p, "/")+"/", k.mount)
+	return path.Join(k.mount, endpoint, rel)
+}
+
+// unwrapKV2 returns a copy of a KV2 read response with the secret's data at
+// the top level. Deleted and destroyed versions have no data.
+func unwrapKV2(secret *api.Secret) *api.Secret {
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	unwrapped := *secret
+	unwrapped.Data = data
+	return &unwrapped
+}
+
+func parseTime(value interface{}) time.Time {
+	s, _ := value.(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// DetectKV returns the mount path and version of the key/value secrets engine
+// holding the given path
+func DetectKV(ctx context.Context, vault *Vault, p string) (string, int, error) {
+	secret, err := vault.Read(ctx, path.Join("sys/internal/ui/mounts", p))
+	if err != nil {
+		return "", 0, err
+	}
+
+	if secret == nil {
+		return "", 0, errors.New("no mount information for path")
+	}
+
+	mount, _ := secret.Data["path"].(string)
+	if mount == "" {
+		return "", 0, errors.New("no mount path in mount information")
+	}
+
+	options, _ := secret.Data["options"].(map[string]interface{})
+	if version, _ := options["version"].(string); version == "2" {
+		return mount, 2, nil
+	}
+
+	return mount, 1, nil
+}
+
+// newBackend returns the backend for the given root according to the
+// configured or detected key/value engine version
+func newBackend(ctx context.Context, vault *Vault, root string, version int) Backend {
+	logger := logrus.WithField("root", root)
+
+	mount, detected, err := DetectKV(ctx, vault, root)
+	if err != nil {
+		if version == 0 {
+			logger.WithError(err).Warn("could not detect key/value engine version, assuming version 1; set --kv-version if the root is on a version 2 mount")
+		} else {
+			logger.WithError(err).Debug("could not detect key/value engine mount")
+		}
+
+		// assume the engine is mounted at the first element of the root
+		mount = strings.SplitN(strings.Trim(root, "/"), "/", 2)[0]
+		detected = 1
+	}
+
+	if version == 0 {
+		version = detected
+	}
+
+	if version == 2 {
+		logger.WithField("mount", mount).Info("using key/value version 2")
+		return NewKV2(vault, mount)
+	}
+
+	return vault
+}
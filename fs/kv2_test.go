@@ -0,0 +1,289 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// kv2Version is a version of a secret in a fake version 2 engine
+type kv2Version struct {
+	data      map[string]interface{}
+	created   string
+	deleted   string
+	destroyed bool
+}
+
+// kv2Secrets are the secrets of the fake version 2 engine mounted at secret/
+var kv2Secrets = map[string][]kv2Version{
+	"db": {
+		{data: map[string]interface{}{"password": "one"}, created: "2018-01-01T00:00:00Z"},
+		{data: map[string]interface{}{"password": "two"}, created: "2018-01-02T00:00:00Z", deleted: "2018-01-03T00:00:00Z"},
+		{data: map[string]interface{}{"password": "three"}, created: "2018-01-04T00:00:00Z", destroyed: true},
+		{data: map[string]interface{}{"password": "four"}, created: "2018-01-05T00:00:00.5Z"},
+	},
+	"team/app": {
+		{data: map[string]interface{}{"user": "admin"}, created: "2018-02-01T00:00:00Z"},
+	},
+}
+
+// newTestKV2 returns a test server for a version 2 engine mounted at secret/
+// holding kv2Secrets, and a backend for it. The server must be closed by the
+// caller.
+func newTestKV2(t *testing.T) (*httptest.Server, *KV2) {
+	server, config, client := newTestVault(t, func(w http.ResponseWriter, r *http.Request) {
+		var body interface{}
+		switch p := strings.TrimPrefix(r.URL.Path+"/", "/v1/secret/"); {
+		case strings.HasPrefix(p, "metadata/") && r.URL.Query().Get("list") == "true":
+			body = kv2List(strings.TrimLeft(strings.TrimPrefix(p, "metadata/"), "/"))
+
+		case strings.HasPrefix(p, "metadata/"):
+			body = kv2Metadata(strings.Trim(strings.TrimPrefix(p, "metadata/"), "/"))
+
+		case strings.HasPrefix(p, "data/"):
+			body = kv2Data(strings.Trim(strings.TrimPrefix(p, "data/"), "/"), r.URL.Query().Get("version"))
+		}
+
+		if body == nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": body})
+	})
+
+	return server, NewKV2(NewVault(client, config.HttpClient, nil), "secret")
+}
+
+func kv2List(prefix string) interface{} {
+	seen := map[string]bool{}
+	keys := []string{}
+	for p := range kv2Secrets {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(p, prefix)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func kv2Metadata(p string) interface{} {
+	versions, ok := kv2Secrets[p]
+	if !ok {
+		return nil
+	}
+
+	info := map[string]interface{}{}
+	for i, v := range versions {
+		info[strconv.Itoa(i+1)] = map[string]interface{}{
+			"created_time":  v.created,
+			"deletion_time": v.deleted,
+			"destroyed":     v.destroyed,
+		}
+	}
+
+	return map[string]interface{}{
+		"created_time":    versions[0].created,
+		"updated_time":    versions[len(versions)-1].created,
+		"current_version": len(versions),
+		"versions":        info,
+	}
+}
+
+func kv2Data(p, version string) interface{} {
+	versions, ok := kv2Secrets[p]
+	if !ok {
+		return nil
+	}
+
+	number := len(versions)
+	if version != "" {
+		number, _ = strconv.Atoi(version)
+	}
+	if number < 1 || number > len(versions) {
+		return nil
+	}
+
+	v := versions[number-1]
+	if v.deleted != "" || v.destroyed {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"data":     v.data,
+		"metadata": map[string]interface{}{"version": number, "created_time": v.created},
+	}
+}
+
+func TestKV2Path(t *testing.T) {
+	kv := NewKV2(nil, "/secret/")
+
+	tests := []struct {
+		path     string
+		contains bool
+		data     string
+	}{
+		{"secret", true, "secret/data"},
+		{"secret/", true, "secret/data"},
+		{"secret/foo", true, "secret/data/foo"},
+		{"/secret/foo/bar/", true, "secret/data/foo/bar"},
+		{"secretive/foo", false, ""},
+		{"sys/mounts", false, ""},
+		{"", false, ""},
+	}
+
+	for _, test := range tests {
+		if got := kv.contains(test.path); got != test.contains {
+			t.Errorf("contains(%q) = %v, want %v", test.path, got, test.contains)
+		}
+		if !test.contains {
+			continue
+		}
+		if got := kv.path("data", test.path); got != test.data {
+			t.Errorf("path(data, %q) = %q, want %q", test.path, got, test.data)
+		}
+	}
+}
+
+func TestKV2Read(t *testing.T) {
+	server, kv := newTestKV2(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		path string
+		want map[string]interface{}
+	}{
+		{"secret/db", map[string]interface{}{"password": "four"}},
+		{"secret/team/app", map[string]interface{}{"user": "admin"}},
+		{"secret/missing", nil},
+	}
+
+	for _, tt := range tests {
+		secret, err := kv.Read(ctx, tt.path)
+		if err != nil {
+			t.Errorf("%s: %s", tt.path, err)
+			continue
+		}
+
+		if tt.want == nil {
+			if secret != nil {
+				t.Errorf("%s: got %v, want nil", tt.path, secret.Data)
+			}
+			continue
+		}
+
+		if secret == nil || !reflect.DeepEqual(secret.Data, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.path, secret, tt.want)
+		}
+	}
+
+	keys, err := kv.List(ctx, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("got keys %v, want db and team/", keys)
+	}
+}
+
+func TestKV2Metadata(t *testing.T) {
+	server, kv := newTestKV2(t)
+	defer server.Close()
+
+	metadata, err := kv.Metadata(context.Background(), "secret/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(day int) time.Time { return time.Date(2018, 1, day, 0, 0, 0, 0, time.UTC) }
+	want := &Metadata{
+		Created: date(1),
+		Updated: date(5).Add(500 * time.Millisecond),
+		Versions: []Version{
+			{Number: 1, Created: date(1)},
+			{Number: 2, Created: date(2), Deleted: date(3)},
+			{Number: 3, Created: date(4), Destroyed: true},
+			{Number: 4, Created: date(5).Add(500 * time.Millisecond)},
+		},
+	}
+
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("got %+v, want %+v", metadata, want)
+	}
+
+	for _, p := range []string{"secret/missing", "other/db"} {
+		if metadata, err := kv.Metadata(context.Background(), p); err != nil || metadata != nil {
+			t.Errorf("%s: got %v, %v, want no metadata", p, metadata, err)
+		}
+	}
+}
+
+func TestKV2ReadVersion(t *testing.T) {
+	server, kv := newTestKV2(t)
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		version int
+		want    map[string]interface{}
+	}{
+		{"secret/db", 1, map[string]interface{}{"password": "one"}},
+		{"secret/db", 4, map[string]interface{}{"password": "four"}},
+		{"secret/db", 2, nil},
+		{"secret/db", 3, nil},
+		{"secret/db", 5, nil},
+		{"other/db", 1, nil},
+	}
+
+	for _, tt := range tests {
+		secret, err := kv.ReadVersion(context.Background(), tt.path, tt.version)
+		if err != nil {
+			t.Errorf("%s@%d: %s", tt.path, tt.version, err)
+			continue
+		}
+
+		var got map[string]interface{}
+		if secret != nil {
+			got = secret.Data
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s@%d: got %v, want %v", tt.path, tt.version, got, tt.want)
+		}
+	}
+}
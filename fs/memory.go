@@ -0,0 +1,142 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// Memory is a Backend holding secrets in memory, for tests and for trying out
+// the filesystem without a Vault server
+type Memory struct {
+	m       sync.RWMutex
+	secrets map[string]*memorySecret
+}
+
+type memorySecret struct {
+	data     map[string]interface{}
+	metadata Metadata
+}
+
+// NewMemory creates a new empty Memory backend and returns it
+func NewMemory() *Memory {
+	return &Memory{secrets: map[string]*memorySecret{}}
+}
+
+// Read returns a copy of the secret at the given path
+func (m *Memory) Read(ctx context.Context, path string) (*api.Secret, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	secret, ok := m.secrets[memoryPath(path)]
+	if !ok {
+		return nil, nil
+	}
+
+	return &api.Secret{Data: copyData(secret.data)}, nil
+}
+
+// List returns the keys directly under the given prefix
+func (m *Memory) List(ctx context.Context, prefix string) ([]string, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	prefix = memoryPath(prefix)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	seen := map[string]bool{}
+	keys := []string{}
+	for p := range m.secrets {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(p, prefix)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Write stores a copy of data at the given path
+func (m *Memory) Write(ctx context.Context, path string, data map[string]interface{}) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	now := time.Now()
+	p := memoryPath(path)
+
+	secret, ok := m.secrets[p]
+	if !ok {
+		secret = &memorySecret{metadata: Metadata{Created: now}}
+		m.secrets[p] = secret
+	}
+	secret.data = copyData(data)
+	secret.metadata.Updated = now
+
+	return nil
+}
+
+// Delete removes the secret at the given path
+func (m *Memory) Delete(ctx context.Context, path string) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	delete(m.secrets, memoryPath(path))
+	return nil
+}
+
+// Metadata returns the creation and update times of the secret at the given
+// path
+func (m *Memory) Metadata(ctx context.Context, path string) (*Metadata, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	secret, ok := m.secrets[memoryPath(path)]
+	if !ok {
+		return nil, nil
+	}
+
+	metadata := secret.metadata
+	return &metadata, nil
+}
+
+func memoryPath(path string) string {
+	return strings.Trim(path, "/")
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,95 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+// newTestRoot returns a root at "secret" over a memory backend holding the
+// given secrets
+func newTestRoot(t *testing.T, opts Options, secrets map[string]map[string]interface{}) (*Root, *Memory) {
+	backend := NewMemory()
+	for p, data := range secrets {
+		if err := backend.Write(context.Background(), p, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if opts.Layout == "" {
+		opts.Layout = LayoutSecret
+	}
+	if opts.Format == "" {
+		opts.Format = FormatSecret
+	}
+	if opts.Write == "" {
+		opts.Write = WriteNone
+	}
+
+	return NewRoot("secret", backend, opts), backend
+}
+
+// names returns the sorted names of the given entries, with a trailing slash
+// for directories
+func names(dirs []fuse.Dirent) []string {
+	out := []string{}
+	for _, d := range dirs {
+		name := d.Name
+		if d.Type == fuse.DT_Dir {
+			name += "/"
+		}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestMemoryList(t *testing.T) {
+	backend := NewMemory()
+	for _, p := range []string{"a", "b/c", "b/d/e", "bb"} {
+		if err := backend.Write(context.Background(), p, map[string]interface{}{"value": p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		keys   []string
+	}{
+		{"", []string{"a", "b/", "bb"}},
+		{"/", []string{"a", "b/", "bb"}},
+		{"b", []string{"c", "d/"}},
+		{"b/", []string{"c", "d/"}},
+		{"b/d", []string{"e"}},
+		{"missing", []string{}},
+	}
+
+	for _, tt := range tests {
+		keys, err := backend.List(context.Background(), tt.prefix)
+		if err != nil {
+			t.Errorf("List(%q): %s", tt.prefix, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("List(%q) = %v, want %v", tt.prefix, keys, tt.keys)
+		}
+	}
+}
@@ -15,10 +15,10 @@
 package fs
 
 import (
+	"encoding/json"
 	"os"
-
-	"hash/crc64"
 	"path"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
@@ -27,72 +27,254 @@ import (
 	"golang.org/x/net/context"
 )
 
-var table = crc64.MakeTable(crc64.ISO)
-
 // Root implements both Node and Handle
 type Root struct {
-	root  string
-	logic *api.Logical
+	root    string
+	backend Backend
+	opts    Options
+	inodes  *inodes
+	cache   *cache
 }
 
-// NewRoot creates a new root and returns it
-func NewRoot(root string, logic *api.Logical) *Root {
+// NewRoot creates a new root over the given backend and returns it
+func NewRoot(root string, backend Backend, opts Options) *Root {
 	return &Root{
-		root:  root,
-		logic: logic,
+		root:    cleanPath(root),
+		backend: backend,
+		opts:    opts,
+		inodes:  newInodes(),
+		cache:   newCache(opts.CacheTTL),
 	}
 }
 
 // Attr sets attrs on the given fuse.Attr
-func (Root) Attr(ctx context.Context, a *fuse.Attr) error {
+func (r *Root) Attr(ctx context.Context, a *fuse.Attr) error {
 	logrus.Debug("handling Root.Attr call")
-	a.Inode = 1
-	a.Mode = os.ModeDir
-	return nil
+	return r.dir().Attr(ctx, a)
 }
 
 // Lookup looks up a path
 func (r *Root) Lookup(ctx context.Context, name string) (fs.Node, error) {
 	logrus.WithField("name", name).Debug("handling Root.Lookup call")
 
-	// TODO: handle context cancellation
-	secret, err := r.logic.Read(path.Join(r.root, name))
-	if secret == nil && err == nil {
-		return nil, fuse.ENOENT
-	} else if err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{"root": r.root, "name": name}).Error("error reading key")
-		return nil, fuse.EIO
+	if name == templatesDir && r.opts.Templates != nil {
+		return r.templates(), nil
 	}
 
-	return Secret{
-		secret,
-		crc64.Checksum([]byte(name), table),
-	}, nil
+	return r.dir().Lookup(ctx, name)
 }
 
-// ReadDirAll returns a list of secrets
+// ReadDirAll returns a list of secrets and prefixes
 func (r *Root) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	logrus.Debug("handling Root.ReadDirAll call")
 
-	secrets, err := r.logic.List(path.Join(r.root))
-	if err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{"root": r.root}).Error("error reading secrets")
-		return nil, fuse.EIO
+	dirs, err := r.dir().ReadDirAll(ctx)
+	if err != nil || r.opts.Templates == nil {
+		return dirs, err
+	}
+
+	// the templates directory shadows anything of the same name in Vault
+	filtered := []fuse.Dirent{}
+	for _, d := range dirs {
+		if d.Name != templatesDir {
+			filtered = append(filtered, d)
+		}
+	}
+
+	return append(filtered, fuse.Dirent{
+		Name:  templatesDir,
+		Inode: r.templates().inode,
+		Type:  fuse.DT_Dir,
+	}), nil
+}
+
+// Create creates a new secret
+func (r *Root) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	logrus.WithField("name", req.Name).Debug("handling Root.Create call")
+	return r.dir().Create(ctx, req, resp)
+}
+
+// Mkdir creates a new prefix or secret
+func (r *Root) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	logrus.WithField("name", req.Name).Debug("handling Root.Mkdir call")
+	return r.dir().Mkdir(ctx, req)
+}
+
+// Remove deletes a secret or an empty prefix
+func (r *Root) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	logrus.WithField("name", req.Name).Debug("handling Root.Remove call")
+	return r.dir().Remove(ctx, req)
+}
+
+// dir returns the directory backing the root of the filesystem
+func (r *Root) dir() *Dir {
+	return NewDir(r, r.root, rootInode)
+}
+
+// templates returns the directory of rendered templates
+func (r *Root) templates() *TemplateDir {
+	return &TemplateDir{
+		root:  r,
+		inode: r.inodes.get(path.Join(r.root, templatesDir) + "/"),
 	}
+}
+
+// secret returns the node for a secret read from the given path, according to
+// the configured layout
+func (r *Root) secret(p string, secret *api.Secret) fs.Node {
+	inode := r.inodes.get(p)
 
-	if secrets.Data["keys"] == nil {
-		return []fuse.Dirent{}, nil
+	if r.opts.Layout == LayoutFields {
+		return NewFields(r, p, secret, inode)
 	}
 
-	dirs := []fuse.Dirent{}
-	for i := 0; i < len(secrets.Data["keys"].([]interface{})); i++ {
-		d := fuse.Dirent{
-			Name:  secrets.Data["keys"].([]interface{})[i].(string),
-			Inode: 1,
-			Type:  fuse.DT_File, // TODO: A lie, consider an alternative
+	return NewSecret(r, p, secret, inode)
+}
+
+// decode converts content written to a secret file into secret data,
+// according to the configured write mode
+func (r *Root) decode(content []byte) (map[string]interface{}, error) {
+	switch r.opts.Write {
+	case WriteValue:
+		return map[string]interface{}{"value": string(content)}, nil
+
+	case WriteJSON:
+		var data map[string]interface{}
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
 		}
-		dirs = append(dirs, d)
+
+		// a full response as read from the file is written back as its data
+		if inner, ok := data["data"].(map[string]interface{}); ok {
+			if _, ok := data["lease_id"]; ok {
+				return inner, nil
+			}
+		}
+
+		return data, nil
 	}
 
-	return dirs, nil
+	return nil, errReadOnly
+}
+
+func (r *Root) fileMode() os.FileMode {
+	if r.opts.Write == WriteNone {
+		return 0444
+	}
+	return 0644
+}
+
+func (r *Root) dirMode() os.FileMode {
+	if r.opts.Write == WriteNone {
+		return 0555
+	}
+	return 0755
+}
+
+// context bounds a backend request by the configured timeout
+func (r *Root) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.opts.Timeout > 0 {
+		return context.WithTimeout(ctx, r.opts.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// read reads the secret at the given path, which is nil if it does not exist
+func (r *Root) read(ctx context.Context, p string) (*api.Secret, error) {
+	p = cleanPath(p)
+	if cached, ok := r.cache.get(opRead, p); ok {
+		return cached.(*api.Secret), nil
+	}
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	secret, err := r.backend.Read(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var lease time.Duration
+	if secret != nil {
+		lease = time.Duration(secret.LeaseDuration) * time.Second
+	}
+
+	r.cache.put(opRead, p, secret, lease)
+	return secret, nil
+}
+
+// list returns the keys directly under the given prefix. Keys for nested
+// prefixes end with a slash.
+func (r *Root) list(ctx context.Context, prefix string) ([]string, error) {
+	prefix = cleanPath(prefix)
+	if cached, ok := r.cache.get(opList, prefix); ok {
+		return cached.([]string), nil
+	}
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	keys, err := r.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.put(opList, prefix, keys, 0)
+	return keys, nil
+}
+
+// metadata returns information about the secret at the given path, which may
+// be nil
+func (r *Root) metadata(ctx context.Context, p string) (*Metadata, error) {
+	p = cleanPath(p)
+	if cached, ok := r.cache.get(opMetadata, p); ok {
+		return cached.(*Metadata), nil
+	}
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	metadata, err := r.backend.Metadata(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.put(opMetadata, p, metadata, 0)
+	return metadata, nil
+}
+
+// times sets the times on the given fuse.Attr from the metadata of the secret
+// at the given path, if the backend keeps any
+func (r *Root) times(ctx context.Context, p string, a *fuse.Attr) error {
+	metadata, err := r.metadata(ctx, p)
+	if err != nil || metadata == nil {
+		return err
+	}
+
+	a.Crtime = metadata.Created
+	a.Ctime = metadata.Updated
+	a.Mtime = metadata.Updated
+	return nil
+}
+
+// write stores data at the given path
+func (r *Root) write(ctx context.Context, p string, data map[string]interface{}) error {
+	p = cleanPath(p)
+	defer r.cache.invalidate(p)
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	return r.backend.Write(ctx, p, data)
+}
+
+// delete deletes the secret at the given path
+func (r *Root) delete(ctx context.Context, p string) error {
+	p = cleanPath(p)
+	defer r.cache.invalidate(p)
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	return r.backend.Delete(ctx, p)
 }
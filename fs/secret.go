@@ -16,8 +16,10 @@ package fs
 
 import (
 	"encoding/json"
+	"sync"
 
 	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/vault/api"
 	"golang.org/x/net/context"
@@ -26,13 +28,43 @@ import (
 // Secret implements Node and Handle
 type Secret struct {
 	*api.Secret
-	inode uint64
+	root   *Root
+	path   string
+	inode  uint64
+	format Format
+
+	// readOnly is set for virtual names, since what is written to them
+	// would not be read back in their format
+	readOnly bool
+
+	m       sync.Mutex
+	content []byte
+	writers
+}
+
+// NewSecret creates a new secret node for the given path
+func NewSecret(root *Root, path string, secret *api.Secret, inode uint64) *Secret {
+	return &Secret{
+		Secret: secret,
+		root:   root,
+		path:   path,
+		inode:  inode,
+		format: root.opts.Format,
+	}
 }
 
 // Attr returns attributes about this Secret
-func (s Secret) Attr(ctx context.Context, a *fuse.Attr) error {
+func (s *Secret) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = s.inode
-	a.Mode = 0444
+	a.Mode = s.root.fileMode()
+	if s.readOnly {
+		a.Mode = 0444
+	}
+
+	if err := s.root.times(ctx, s.path, a); err != nil {
+		logrus.WithError(err).WithField("path", s.path).Error("error reading metadata")
+		return errno(err)
+	}
 
 	content, err := s.ReadAll(ctx)
 	if err != nil {
@@ -44,7 +76,110 @@ func (s Secret) Attr(ctx context.Context, a *fuse.Attr) error {
 	return nil
 }
 
-// ReadAll gets the content of this Secret
-func (s Secret) ReadAll(ctx context.Context) ([]byte, error) {
-	return json.Marshal(s)
+// ReadAll gets the content of this Secret in the configured format. The
+// content is rendered once and kept until the Secret changes.
+func (s *Secret) ReadAll(ctx context.Context) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.content == nil {
+		content, err := s.format.Render(s.Secret)
+		if err != nil {
+			return nil, err
+		}
+		s.content = content
+	}
+
+	return s.content, nil
+}
+
+// Open opens this Secret for reading, or for writing if enabled. Written
+// content replaces the whole secret. Write handles start with the current
+// content, unless opened with O_TRUNC, so appending and partial writes keep
+// the rest of the secret.
+func (s *Secret) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if req.Flags.IsReadOnly() {
+		return s, nil
+	}
+
+	if !s.writable() {
+		return nil, errReadOnly
+	}
+
+	var content []byte
+	if req.Flags&fuse.OpenTruncate == 0 {
+		var err error
+		if content, err = s.editable(ctx); err != nil {
+			logrus.WithError(err).WithField("path", s.path).Error("error rendering secret")
+			return nil, fuse.EIO
+		}
+	}
+
+	resp.Flags |= fuse.OpenDirectIO
+	return s.open(content, s.commit), nil
+}
+
+// editable returns the content of this Secret as it is written back in the
+// configured write mode. That is the rendered content where it decodes to the
+// same data, and otherwise the value or the data as JSON.
+func (s *Secret) editable(ctx context.Context) ([]byte, error) {
+	if s.root.opts.Write == WriteJSON && (s.format == FormatSecret || s.format == FormatJSON) {
+		content, err := s.ReadAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, content...), nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.root.opts.Write == WriteValue {
+		value, ok := s.Data["value"]
+		if !ok {
+			return []byte{}, nil
+		}
+		return fieldBytes(value)
+	}
+
+	return json.Marshal(s.Data)
+}
+
+// Setattr handles truncation of open handles
+func (s *Secret) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		if !s.writable() {
+			return errReadOnly
+		}
+		s.truncate(req.Size)
+	}
+
+	return s.Attr(ctx, &resp.Attr)
+}
+
+// writable checks whether this Secret can be opened for writing
+func (s *Secret) writable() bool {
+	return !s.readOnly && s.root.opts.Write != WriteNone
+}
+
+func (s *Secret) commit(ctx context.Context, content []byte) error {
+	data, err := s.root.decode(content)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("path", s.path).Debug("writing secret")
+	if err := s.root.write(ctx, s.path, data); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	updated := *s.Secret
+	updated.Data = data
+	s.Secret = &updated
+	s.content = nil
+
+	return nil
 }
@@ -0,0 +1,154 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+func TestSecretReadAll(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   map[string]interface{}
+		want   string
+	}{
+		{FormatJSON, map[string]interface{}{"a": "b"}, `{"a":"b"}`},
+		{FormatYAML, map[string]interface{}{"a": "b"}, "a: b\n"},
+		{FormatEnv, map[string]interface{}{"a": "b c", "d": "e"}, "a='b c'\nd=e\n"},
+		{FormatRaw, map[string]interface{}{"value": "v", "other": "o"}, "v"},
+		{FormatRaw, map[string]interface{}{"only": "o"}, "o"},
+	}
+
+	for _, tt := range tests {
+		root, _ := newTestRoot(t, Options{Format: tt.format}, map[string]map[string]interface{}{"secret/db": tt.data})
+
+		node, err := root.Lookup(context.Background(), "db")
+		if err != nil {
+			t.Errorf("%s: %s", tt.format, err)
+			continue
+		}
+
+		content, err := node.(*Secret).ReadAll(context.Background())
+		if err != nil {
+			t.Errorf("%s: %s", tt.format, err)
+			continue
+		}
+
+		if string(content) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.format, content, tt.want)
+		}
+	}
+}
+
+func TestSecretWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		write  WriteMode
+		format Format
+		flags  fuse.OpenFlags
+		offset int64
+		data   string
+		want   map[string]interface{}
+	}{
+		{
+			name: "append value", write: WriteValue,
+			flags: fuse.OpenWriteOnly | fuse.OpenAppend, offset: 3, data: "def",
+			want: map[string]interface{}{"value": "abcdef"},
+		},
+		{
+			name: "overwrite start of value", write: WriteValue,
+			flags: fuse.OpenReadWrite, offset: 0, data: "x",
+			want: map[string]interface{}{"value": "xbc"},
+		},
+		{
+			name: "truncate value", write: WriteValue,
+			flags: fuse.OpenWriteOnly | fuse.OpenTruncate, offset: 0, data: "def",
+			want: map[string]interface{}{"value": "def"},
+		},
+		{
+			name: "replace json", write: WriteJSON, format: FormatJSON,
+			flags: fuse.OpenWriteOnly | fuse.OpenTruncate, offset: 0, data: `{"a":"b"}`,
+			want: map[string]interface{}{"a": "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		root, backend := newTestRoot(t, Options{Write: tt.write, Format: tt.format}, map[string]map[string]interface{}{
+			"secret/db": {"value": "abc"},
+		})
+
+		node, err := root.Lookup(context.Background(), "db")
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		handle, err := node.(*Secret).Open(context.Background(), &fuse.OpenRequest{Flags: tt.flags}, &fuse.OpenResponse{})
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		write(t, handle.(*Handle), tt.offset, tt.data)
+
+		secret, _ := backend.Read(context.Background(), "secret/db")
+		if secret == nil || !reflect.DeepEqual(secret.Data, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, secret, tt.want)
+		}
+	}
+}
+
+func TestSecretOpenReadWrite(t *testing.T) {
+	tests := []struct {
+		write  WriteMode
+		format Format
+		want   string
+	}{
+		{WriteValue, FormatSecret, "abc"},
+		{WriteJSON, FormatJSON, `{"value":"abc"}`},
+		{WriteJSON, FormatYAML, `{"value":"abc"}`},
+	}
+
+	for _, tt := range tests {
+		root, _ := newTestRoot(t, Options{Write: tt.write, Format: tt.format}, map[string]map[string]interface{}{
+			"secret/db": {"value": "abc"},
+		})
+
+		node, _ := root.Lookup(context.Background(), "db")
+		handle, err := node.(*Secret).Open(context.Background(), &fuse.OpenRequest{Flags: fuse.OpenReadWrite}, &fuse.OpenResponse{})
+		if err != nil {
+			t.Errorf("%s/%s: %s", tt.write, tt.format, err)
+			continue
+		}
+
+		content, _ := handle.(*Handle).ReadAll(context.Background())
+		if string(content) != tt.want {
+			t.Errorf("%s/%s: got %q, want %q", tt.write, tt.format, content, tt.want)
+		}
+	}
+}
+
+func TestSecretOpenReadOnly(t *testing.T) {
+	root, _ := newTestRoot(t, Options{}, map[string]map[string]interface{}{"secret/db": {"value": "abc"}})
+	node, _ := root.Lookup(context.Background(), "db")
+
+	if _, err := node.(*Secret).Open(context.Background(), &fuse.OpenRequest{Flags: fuse.OpenWriteOnly}, &fuse.OpenResponse{}); err != errReadOnly {
+		t.Errorf("got error %v, want %v", err, errReadOnly)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// templatesDir is the name of the directory in the root of the filesystem
+// holding rendered templates
+const templatesDir = "_templates"
+
+// Templates is a set of user-supplied templates, rendered from Vault secrets
+// when read
+type Templates struct {
+	names []string
+	tmpl  *template.Template
+}
+
+// ParseTemplates parses every file in the given directory as a template named
+// after the file
+func ParseTemplates(dir string) (*Templates, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{tmpl: template.New("").Funcs(templateFuncs(nil))}
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := t.tmpl.New(file.Name()).Parse(string(content)); err != nil {
+			return nil, err
+		}
+		t.names = append(t.names, file.Name())
+	}
+	sort.Strings(t.names)
+
+	return t, nil
+}
+
+// render executes the named template, reading secrets with the given function
+func (t *Templates) render(name string, read func(string) (*api.Secret, error)) ([]byte, error) {
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(templateFuncs(read)).ExecuteTemplate(&buf, name, nil); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (t *Templates) has(name string) bool {
+	i := sort.SearchStrings(t.names, name)
+	return i < len(t.names) && t.names[i] == name
+}
+
+// templateFuncs returns the functions available to templates. `secret` returns
+// the data of the secret at a full Vault path, as in
+// {{ (secret "secret/db").password }}.
+func templateFuncs(read func(string) (*api.Secret, error)) template.FuncMap {
+	return template.FuncMap{
+		"secret": func(p string) (map[string]interface{}, error) {
+			secret, err := read(p)
+			if err != nil {
+				return nil, err
+			}
+
+			if secret == nil {
+				return nil, fmt.Errorf("no secret at %s", p)
+			}
+
+			return secret.Data, nil
+		},
+	}
+}
+
+// TemplateDir implements both Node and Handle for the directory of rendered
+// templates
+type TemplateDir struct {
+	root  *Root
+	inode uint64
+}
+
+// Attr sets attrs on the given fuse.Attr
+func (t *TemplateDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = t.inode
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+// Lookup looks up a template
+func (t *TemplateDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	logrus.WithField("name", name).Debug("handling TemplateDir.Lookup call")
+
+	if !t.root.opts.Templates.has(name) {
+		return nil, fuse.ENOENT
+	}
+
+	return &Template{
+		root:  t.root,
+		name:  name,
+		inode: t.root.inodes.get(path.Join(t.root.root, templatesDir, name)),
+	}, nil
+}
+
+// ReadDirAll returns a list of templates
+func (t *TemplateDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	logrus.Debug("handling TemplateDir.ReadDirAll call")
+
+	dirs := []fuse.Dirent{}
+	for _, name := range t.root.opts.Templates.names {
+		dirs = append(dirs, fuse.Dirent{
+			Name:  name,
+			Inode: t.root.inodes.get(path.Join(t.root.root, templatesDir, name)),
+			Type:  fuse.DT_File,
+		})
+	}
+
+	return dirs, nil
+}
+
+// Template implements Node and Handle for a rendered template
+type Template struct {
+	root  *Root
+	name  string
+	inode uint64
+}
+
+// Attr returns attributes about this Template
+func (t *Template) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = t.inode
+	a.Mode = 0444
+
+	content, err := t.ReadAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.Size = uint64(len(content))
+	return nil
+}
+
+// ReadAll renders this Template
+func (t *Template) ReadAll(ctx context.Context) ([]byte, error) {
+	read := func(p string) (*api.Secret, error) {
+		return t.root.read(ctx, p)
+	}
+
+	content, err := t.root.opts.Templates.render(t.name, read)
+	if err != nil {
+		logrus.WithError(err).WithField("template", t.name).Error("error rendering template")
+		return nil, errno(err)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,156 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+// parseTestTemplates parses the given templates from a temporary directory
+func parseTestTemplates(t *testing.T, templates map[string]string) *Templates {
+	dir, err := ioutil.TempDir("", "vaultfs-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// directories are not templates
+	if err := os.Mkdir(filepath.Join(dir, "partials"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed
+}
+
+func TestTemplates(t *testing.T) {
+	templates := parseTestTemplates(t, map[string]string{
+		"app.conf":     `password={{ (secret "secret/db").password }}`,
+		"other.conf":   `x={{ (secret "other/x").value }}`,
+		"missing.conf": `{{ (secret "secret/missing").value }}`,
+	})
+
+	root, _ := newTestRoot(t, Options{Templates: templates}, dirSecrets)
+	ctx := context.Background()
+
+	dirs, err := root.ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(dirs), []string{templatesDir + "/", "db", "team/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("root: got %v, want %v", got, want)
+	}
+
+	node, err := root.Lookup(ctx, templatesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := node.(*TemplateDir)
+
+	dirs, err = dir.ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(dirs), []string{"app.conf", "missing.conf", "other.conf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("templates: got %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"app.conf", "password=hunter2", nil},
+		{"other.conf", "x=x", nil},
+		{"missing.conf", "", fuse.EIO},
+	}
+
+	for _, tt := range tests {
+		node, err := dir.Lookup(ctx, tt.name)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		content, err := node.(*Template).ReadAll(ctx)
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+
+		if string(content) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, content, tt.want)
+		}
+	}
+
+	if _, err := dir.Lookup(ctx, "partials"); err != fuse.ENOENT {
+		t.Errorf("partials: got error %v, want %v", err, fuse.ENOENT)
+	}
+}
+
+func TestTemplateAttr(t *testing.T) {
+	templates := parseTestTemplates(t, map[string]string{
+		"app.conf": `password={{ (secret "secret/db").password }}`,
+	})
+	root, _ := newTestRoot(t, Options{Templates: templates, Write: WriteValue}, dirSecrets)
+	ctx := context.Background()
+
+	node, err := root.templates().Lookup(ctx, "app.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attr fuse.Attr
+	if err := node.(*Template).Attr(ctx, &attr); err != nil {
+		t.Fatal(err)
+	}
+
+	if attr.Mode != 0444 || attr.Size != uint64(len("password=hunter2")) {
+		t.Errorf("got mode %v and size %d", attr.Mode, attr.Size)
+	}
+}
+
+func TestParseTemplatesInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vaultfs-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad"), []byte("{{ .Unclosed "), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseTemplates(dir); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
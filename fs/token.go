@@ -0,0 +1,306 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/vault/api"
+	"gopkg.in/fsnotify.v1"
+)
+
+// retryToken is the time to wait before retrying a failed renewal or login
+const retryToken = 15 * time.Second
+
+// tokenManager keeps a token valid. Renewable tokens are renewed when two
+// thirds of their TTL have passed. When a token cannot be renewed any further,
+// the manager logs in again with the configured auth method, if any. A token
+// read from a file is replaced whenever the file changes.
+//
+// The token is kept here rather than set on a shared client, since a client's
+// token cannot be changed safely while requests are using it.
+type tokenManager struct {
+	config *api.Config
+	auth   Authenticator
+	reload chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+
+	m     sync.RWMutex
+	token string
+}
+
+// newTokenManager returns a manager for the given token. It does nothing
+// until started.
+func newTokenManager(config *api.Config, token string, auth Authenticator) *tokenManager {
+	return &tokenManager{
+		config: config,
+		auth:   auth,
+		reload: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		token:  token,
+	}
+}
+
+// Token returns the current token
+func (t *tokenManager) Token() string {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	return t.token
+}
+
+// setToken replaces the current token
+func (t *tokenManager) setToken(token string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.token = token
+}
+
+// client returns a new client with the current token
+func (t *tokenManager) client() (*api.Client, error) {
+	client, err := api.NewClient(t.config)
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetToken(t.Token())
+	return client, nil
+}
+
+// close stops the manager. It may be called more than once.
+func (t *tokenManager) close() {
+	t.once.Do(func() { close(t.stop) })
+}
+
+// login replaces the token by logging in with the auth method
+func (t *tokenManager) login() (*api.SecretAuth, error) {
+	auth, err := login(t.config, t.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	t.setToken(auth.ClientToken)
+	return auth, nil
+}
+
+// lookup returns the remaining TTL of the current token and whether it can be
+// renewed
+func (t *tokenManager) lookup() (time.Duration, bool, error) {
+	client, err := t.client()
+	if err != nil {
+		return 0, false, err
+	}
+
+	secret, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		return 0, false, err
+	}
+
+	renewable, _ := secret.Data["renewable"].(bool)
+	return seconds(secret.Data["ttl"]), renewable, nil
+}
+
+// run keeps the token valid until stopped. The TTL and renewability of the
+// current token are looked up first, unless it was just returned by a login,
+// and again whenever the token is reloaded.
+func (t *tokenManager) run(auth *api.SecretAuth) {
+	var (
+		ttl       time.Duration
+		renewable bool
+		err       error
+	)
+
+	if auth != nil {
+		ttl, renewable = time.Duration(auth.LeaseDuration)*time.Second, auth.Renewable
+	} else {
+		ttl, renewable, err = t.lookup()
+	}
+
+	for {
+		logger := logrus.WithFields(logrus.Fields{"ttl": ttl, "renewable": renewable})
+
+		var renew <-chan time.Time
+		switch {
+		case err != nil:
+			logrus.WithError(err).Warn("could not look up token, it will not be renewed")
+
+		case ttl <= 0:
+			logger.Info("token does not expire")
+
+		case !renewable && t.auth == nil:
+			logger.Warn("token cannot be renewed and will expire")
+
+		default:
+			logger.Debug("waiting to renew token")
+			renew = time.After(ttl * 2 / 3)
+		}
+
+		select {
+		case <-renew:
+			ttl, renewable = t.refresh(renewable)
+		case <-t.reload:
+			ttl, renewable, err = t.lookup()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// refresh renews the current token if possible, or else logs in again, and
+// returns the TTL and renewability of the resulting token. Failures are
+// retried until stopped.
+func (t *tokenManager) refresh(renewable bool) (time.Duration, bool) {
+	for {
+		if renewable {
+			secret, err := t.renew()
+			switch {
+			case err != nil:
+				logrus.WithError(err).Error("error renewing token")
+
+			case secret.Auth == nil:
+				logrus.Error("renewal response did not contain a token")
+
+			// a token at its max TTL is renewed for less each time, so log
+			// in before it runs out
+			case t.auth != nil && time.Duration(secret.Auth.LeaseDuration)*time.Second <= retryToken:
+				logrus.Info("token is near its max TTL, logging in again")
+
+			default:
+				logrus.WithField("ttl", secret.Auth.LeaseDuration).Info("renewed token")
+				return time.Duration(secret.Auth.LeaseDuration) * time.Second, secret.Auth.Renewable
+			}
+		}
+
+		if t.auth != nil {
+			auth, err := t.login()
+			if err == nil {
+				logrus.Info("logged in again")
+				return time.Duration(auth.LeaseDuration) * time.Second, auth.Renewable
+			}
+			logrus.WithError(err).Error("error logging in again")
+		}
+
+		logrus.WithField("retry", retryToken).Warn("could not refresh token, retrying")
+		select {
+		case <-time.After(retryToken):
+		case <-t.stop:
+			return 0, false
+		}
+	}
+}
+
+// renew renews the current token
+func (t *tokenManager) renew() (*api.Secret, error) {
+	client, err := t.client()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Auth().Token().RenewSelf(0)
+}
+
+// watch replaces the token whenever the given file changes,
+// until stopped. The directory is watched rather than the file, since agents
+// usually replace the file by renaming a new one over it.
+func (t *tokenManager) watch(file string) error {
+	file = filepath.Clean(file)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case event := <-watcher.Events:
+				if filepath.Clean(event.Name) != file || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+
+				logger := logrus.WithField("file", file)
+
+				token, err := readToken(file)
+				if err != nil {
+					logger.WithError(err).Error("error reading token file")
+					continue
+				}
+
+				if token == t.Token() {
+					continue
+				}
+
+				logger.Info("token file changed, using new token")
+				t.setToken(token)
+
+				select {
+				case t.reload <- struct{}{}:
+				default:
+				}
+
+			case err := <-watcher.Errors:
+				logrus.WithError(err).WithField("file", file).Error("error watching token file")
+
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// readToken reads a token from the given file
+func readToken(file string) (string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", errors.New("token file is empty")
+	}
+
+	return token, nil
+}
+
+// seconds converts a number of seconds in a decoded response to a duration
+func seconds(v interface{}) time.Duration {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return time.Duration(i) * time.Second
+	case float64:
+		return time.Duration(n) * time.Second
+	}
+	return 0
+}
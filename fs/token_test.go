@@ -0,0 +1,252 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// testAuth logs in by returning a fixed token
+type testAuth struct {
+	ttl int
+
+	m      sync.Mutex
+	logins int
+}
+
+func (a *testAuth) Login(client *api.Client) (*api.SecretAuth, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	a.logins++
+	return &api.SecretAuth{
+		ClientToken:   fmt.Sprintf("login-%d", a.logins),
+		LeaseDuration: a.ttl,
+		Renewable:     true,
+	}, nil
+}
+
+func (a *testAuth) count() int {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	return a.logins
+}
+
+// newTestTokens starts a test server looking up tokens with the given TTL and
+// renewing them for the given TTL, or failing to if it is negative. It
+// returns a manager for the token "initial" using the server, a function
+// returning the tokens renewed so far, and a function closing the server.
+func newTestTokens(t *testing.T, lookupTTL, renewTTL int, auth Authenticator) (*tokenManager, func() []string, func()) {
+	var (
+		m       sync.Mutex
+		renewed []string
+	)
+
+	server, config, _ := newTestVault(t, func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Vault-Token")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprintf(w, `{"data": {"id": %q, "ttl": %d, "renewable": true}}`, token, lookupTTL)
+
+		case "/v1/auth/token/renew-self":
+			m.Lock()
+			renewed = append(renewed, token)
+			m.Unlock()
+
+			if renewTTL < 0 {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors": ["permission denied"]}`))
+				return
+			}
+			fmt.Fprintf(w, `{"auth": {"client_token": %q, "lease_duration": %d, "renewable": true}}`, token, renewTTL)
+
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	get := func() []string {
+		m.Lock()
+		defer m.Unlock()
+
+		return append([]string{}, renewed...)
+	}
+
+	return newTokenManager(config, "initial", auth), get, server.Close
+}
+
+func TestTokenRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		renewable bool
+		renewTTL  int
+		auth      bool
+		ttl       time.Duration
+		token     string
+		renewed   int
+		logins    int
+	}{
+		{
+			name:      "renew",
+			renewable: true,
+			renewTTL:  3600,
+			auth:      true,
+			ttl:       time.Hour,
+			token:     "initial",
+			renewed:   1,
+		},
+		{
+			name:      "renew near max TTL",
+			renewable: true,
+			renewTTL:  10,
+			auth:      true,
+			ttl:       time.Hour,
+			token:     "login-1",
+			renewed:   1,
+			logins:    1,
+		},
+		{
+			name:      "renew near max TTL without auth",
+			renewable: true,
+			renewTTL:  10,
+			ttl:       10 * time.Second,
+			token:     "initial",
+			renewed:   1,
+		},
+		{
+			name:      "renewal fails",
+			renewable: true,
+			renewTTL:  -1,
+			auth:      true,
+			ttl:       time.Hour,
+			token:     "login-1",
+			renewed:   1,
+			logins:    1,
+		},
+		{
+			name:     "not renewable",
+			renewTTL: 3600,
+			auth:     true,
+			ttl:      time.Hour,
+			token:    "login-1",
+			logins:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		auth := &testAuth{ttl: 3600}
+		var authenticator Authenticator
+		if tt.auth {
+			authenticator = auth
+		}
+
+		tokens, renewed, stop := newTestTokens(t, 0, tt.renewTTL, authenticator)
+		ttl, renewable := tokens.refresh(tt.renewable)
+		stop()
+
+		if ttl != tt.ttl || !renewable {
+			t.Errorf("%s: got %s, %v, want %s, true", tt.name, ttl, renewable, tt.ttl)
+		}
+		if token := tokens.Token(); token != tt.token {
+			t.Errorf("%s: token = %q, want %q", tt.name, token, tt.token)
+		}
+		if got := renewed(); len(got) != tt.renewed {
+			t.Errorf("%s: renewed %v, want %d renewals", tt.name, got, tt.renewed)
+		}
+		if auth.count() != tt.logins {
+			t.Errorf("%s: logged in %d times, want %d", tt.name, auth.count(), tt.logins)
+		}
+	}
+}
+
+func TestTokenRefreshStopped(t *testing.T) {
+	tokens, _, stop := newTestTokens(t, 0, -1, nil)
+	defer stop()
+
+	// a failed renewal is retried until stopped
+	tokens.close()
+	if ttl, renewable := tokens.refresh(true); ttl != 0 || renewable {
+		t.Errorf("got %s, %v, want 0, false", ttl, renewable)
+	}
+}
+
+func TestTokenRun(t *testing.T) {
+	auth := &testAuth{ttl: 3600}
+
+	// the token is looked up with a one second TTL and renewed for ten
+	// seconds, which is near its max TTL, so the manager logs in again
+	tokens, renewed, stop := newTestTokens(t, 1, 10, auth)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		tokens.run(nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tokens.Token() != "login-1" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tokens.close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after close")
+	}
+
+	if token := tokens.Token(); token != "login-1" {
+		t.Errorf("token = %q, want login-1", token)
+	}
+	if got := renewed(); len(got) != 1 || got[0] != "initial" {
+		t.Errorf("renewed %v, want [initial]", got)
+	}
+	if auth.count() != 1 {
+		t.Errorf("logged in %d times, want 1", auth.count())
+	}
+}
+
+func TestTokenRunNoExpiry(t *testing.T) {
+	tokens, renewed, stop := newTestTokens(t, 0, 3600, nil)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		tokens.run(&api.SecretAuth{ClientToken: "initial"})
+		close(done)
+	}()
+
+	tokens.close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after close")
+	}
+
+	if got := renewed(); len(got) != 0 {
+		t.Errorf("renewed %v, want no renewals", got)
+	}
+}
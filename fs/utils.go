@@ -16,22 +16,100 @@ package fs
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
 
 	"github.com/hashicorp/vault/api"
 )
 
+// TLSOptions configures the TLS connection to Vault
+type TLSOptions struct {
+	// Insecure skips verification of the server's certificate
+	Insecure bool
+
+	// CACert is a PEM file of CA certificates to verify the server with, and
+	// CAPath a directory of them. The system roots are used if both are empty.
+	CACert string
+	CAPath string
+
+	// ClientCert and ClientKey are a PEM certificate and key presented to
+	// the server, as used by the cert auth method
+	ClientCert string
+	ClientKey  string
+
+	// ServerName overrides the name the server's certificate is verified for
+	ServerName string
+}
+
 // NewConfig creates a new config
-func NewConfig(address string, insecure bool) *api.Config {
+func NewConfig(address string, opts TLSOptions) (*api.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: opts.Insecure,
+		ServerName:         opts.ServerName,
+	}
+
+	if opts.CACert != "" || opts.CAPath != "" {
+		pool, err := certPool(opts.CACert, opts.CAPath)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
 	return &api.Config{
 		Address: address,
 		HttpClient: &http.Client{
 			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: insecure,
-				},
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: config,
 			},
 		},
+	}, nil
+}
+
+// certPool loads the CA certificates in the given file and in the files of
+// the given directory
+func certPool(file, dir string) (*x509.CertPool, error) {
+	files := []string{}
+	if file != "" {
+		files = append(files, file)
+	}
+
+	if dir != "" {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() {
+				files = append(files, filepath.Join(dir, info.Name()))
+			}
+		}
 	}
+
+	pool := x509.NewCertPool()
+	for _, name := range files {
+		pem, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", name)
+		}
+	}
+
+	return pool, nil
 }
@@ -0,0 +1,167 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// Vault is a Backend using the logical API of Vault. Requests are built by a
+// Vault client, but sent through the HTTP client directly, since the Vault
+// client cannot cancel them.
+type Vault struct {
+	client *api.Client
+	http   *http.Client
+	token  func() string
+}
+
+// NewVault creates a new Vault backend sending requests built by the given
+// client through the given HTTP client, which should be the one the client
+// was configured with. Requests use the token returned by the given function,
+// or the client's own token if it is nil.
+func NewVault(client *api.Client, httpClient *http.Client, token func() string) *Vault {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Vault{
+		client: client,
+		http:   httpClient,
+		token:  token,
+	}
+}
+
+// Read reads a secret from Vault
+func (v *Vault) Read(ctx context.Context, path string) (*api.Secret, error) {
+	return v.do(ctx, "GET", path, nil, nil)
+}
+
+// readParams reads a secret from Vault with the given query parameters
+func (v *Vault) readParams(ctx context.Context, path string, params url.Values) (*api.Secret, error) {
+	return v.do(ctx, "GET", path, params, nil)
+}
+
+// List lists a prefix in Vault
+func (v *Vault) List(ctx context.Context, prefix string) ([]string, error) {
+	secret, err := v.do(ctx, "GET", prefix, url.Values{"list": []string{"true"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return listKeys(secret)
+}
+
+// Write writes a secret to Vault
+func (v *Vault) Write(ctx context.Context, path string, data map[string]interface{}) error {
+	_, err := v.do(ctx, "PUT", path, nil, data)
+	return err
+}
+
+// Delete deletes a secret from Vault
+func (v *Vault) Delete(ctx context.Context, path string) error {
+	_, err := v.do(ctx, "DELETE", path, nil, nil)
+	return err
+}
+
+// Metadata returns nil, since generic secret backends do not keep metadata
+func (v *Vault) Metadata(ctx context.Context, path string) (*Metadata, error) {
+	return nil, nil
+}
+
+// do sends a request to Vault and parses the response. The request is
+// cancelled when the context is done. Reading a path that does not exist
+// returns nil, as does a response without a body.
+func (v *Vault) do(ctx context.Context, method, path string, params url.Values, body interface{}) (*api.Secret, error) {
+	r := v.client.NewRequest(method, "/v1/"+path)
+	if v.token != nil {
+		r.ClientToken = v.token()
+	}
+	for key, values := range params {
+		r.Params[key] = values
+	}
+
+	if body != nil {
+		if err := r.SetJSONBody(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := r.ToHTTP()
+	if err != nil {
+		return nil, err
+	}
+	req.Cancel = ctx.Done()
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == "GET":
+		return nil, nil
+
+	case resp.StatusCode == http.StatusNoContent:
+		return nil, nil
+
+	case resp.StatusCode < 200 || resp.StatusCode >= 400:
+		return nil, responseError(method, path, resp)
+	}
+
+	return api.ParseSecret(resp.Body)
+}
+
+// responseError returns the error for a failed response, with the errors
+// Vault gave for it
+func responseError(method, path string, resp *http.Response) error {
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	return fmt.Errorf("error making API request %s %s: code %d: %s", method, path, resp.StatusCode, strings.Join(body.Errors, ", "))
+}
+
+// listKeys returns the keys of a list response
+func listKeys(secret *api.Secret) ([]string, error) {
+	if secret == nil || secret.Data["keys"] == nil {
+		return []string{}, nil
+	}
+
+	raw, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for keys", secret.Data["keys"])
+	}
+
+	keys := make([]string, 0, len(raw))
+	for _, key := range raw {
+		if s, ok := key.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,69 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+)
+
+// newTestVault returns a test server with the given handler and a client for
+// it. The server must be closed by the caller.
+func newTestVault(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *api.Config, *api.Client) {
+	server := httptest.NewServer(handler)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	return server, config, client
+}
+
+func TestVaultToken(t *testing.T) {
+	var got []string
+	server, config, client := newTestVault(t, func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-Vault-Token"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+	client.SetToken("initial")
+
+	tokens := newTokenManager(config, "first", nil)
+	vault := NewVault(client, config.HttpClient, tokens.Token)
+
+	if _, err := vault.Read(context.Background(), "secret/foo"); err != nil {
+		t.Fatal(err)
+	}
+	tokens.setToken("second")
+	if _, err := vault.Read(context.Background(), "secret/foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("tokens = %v, want [first second]", got)
+	}
+	if client.Token() != "initial" {
+		t.Errorf("client token = %q, want it unchanged", client.Token())
+	}
+}
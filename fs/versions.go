@@ -0,0 +1,258 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// versionsDir is the name of the hidden directory holding earlier versions of
+// secrets, on backends that keep them. In the fields layout it is inside each
+// secret's directory, otherwise it is inside each prefix and holds one
+// directory per secret.
+const versionsDir = ".versions"
+
+// History implements both Node and Handle for the versions directory of a
+// prefix, which has a Versions directory for each secret in the prefix
+type History struct {
+	root  *Root
+	path  string
+	inode uint64
+}
+
+// Attr sets attrs on the given fuse.Attr
+func (h *History) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = h.inode
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+// Lookup looks up the versions of a secret
+func (h *History) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	logrus.WithFields(logrus.Fields{"path": h.path, "name": name}).Debug("handling History.Lookup call")
+	return h.root.versions(ctx, path.Join(h.path, name))
+}
+
+// ReadDirAll returns a list of the secrets in the prefix
+func (h *History) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	logrus.WithField("path", h.path).Debug("handling History.ReadDirAll call")
+
+	keys, err := h.root.list(ctx, h.path)
+	if err != nil {
+		logrus.WithError(err).WithField("path", h.path).Error("error listing prefix")
+		return nil, errno(err)
+	}
+
+	dirs := []fuse.Dirent{}
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		dirs = append(dirs, fuse.Dirent{
+			Name:  key,
+			Inode: h.root.inodes.get(path.Join(h.path, key, versionsDir) + "/"),
+			Type:  fuse.DT_Dir,
+		})
+	}
+
+	return dirs, nil
+}
+
+// Versions implements both Node and Handle for the versions of a secret
+type Versions struct {
+	root     *Root
+	path     string
+	inode    uint64
+	versions []Version
+}
+
+// Attr sets attrs on the given fuse.Attr
+func (v *Versions) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = v.inode
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+// Lookup looks up a version by number
+func (v *Versions) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	logrus.WithFields(logrus.Fields{"path": v.path, "name": name}).Debug("handling Versions.Lookup call")
+
+	number, err := strconv.Atoi(name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	for _, version := range v.versions {
+		if version.Number == number {
+			return v.version(version), nil
+		}
+	}
+
+	return nil, fuse.ENOENT
+}
+
+// ReadDirAll returns a list of version numbers
+func (v *Versions) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	logrus.WithField("path", v.path).Debug("handling Versions.ReadDirAll call")
+
+	dirs := []fuse.Dirent{}
+	for _, version := range v.versions {
+		node := v.version(version)
+		dirs = append(dirs, fuse.Dirent{
+			Name:  strconv.Itoa(version.Number),
+			Inode: node.inode,
+			Type:  fuse.DT_File,
+		})
+	}
+
+	return dirs, nil
+}
+
+func (v *Versions) version(version Version) *SecretVersion {
+	name := strconv.Itoa(version.Number)
+	return &SecretVersion{
+		root:    v.root,
+		path:    v.path,
+		version: version,
+		inode:   v.root.inodes.get(path.Join(v.path, versionsDir, name)),
+	}
+}
+
+// SecretVersion implements Node and Handle for one version of a secret. It is
+// read-only. Deleted versions are only readable by the owner and destroyed
+// versions not at all, and both are empty.
+type SecretVersion struct {
+	root    *Root
+	path    string
+	version Version
+	inode   uint64
+
+	m       sync.Mutex
+	content []byte
+}
+
+// Attr returns attributes about this SecretVersion
+func (s *SecretVersion) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = s.inode
+	a.Mode = 0444
+	a.Crtime = s.version.Created
+	a.Ctime = s.version.Created
+	a.Mtime = s.version.Created
+
+	switch {
+	case s.version.Destroyed:
+		a.Mode = 0000
+		return nil
+	case !s.version.Deleted.IsZero():
+		a.Mode = 0400
+		a.Ctime = s.version.Deleted
+		return nil
+	}
+
+	content, err := s.ReadAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.Size = uint64(len(content))
+	return nil
+}
+
+// ReadAll gets the content of this SecretVersion in the configured format.
+// Versions never change, so the content is only read once.
+func (s *SecretVersion) ReadAll(ctx context.Context) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.content != nil {
+		return s.content, nil
+	}
+
+	reader, ok := s.root.backend.(VersionReader)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	ctx, cancel := s.root.context(ctx)
+	defer cancel()
+
+	secret, err := reader.ReadVersion(ctx, s.path, s.version.Number)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"path": s.path, "version": s.version.Number}).Error("error reading version")
+		return nil, errno(err)
+	}
+
+	if secret == nil {
+		return []byte{}, nil
+	}
+
+	content, err := s.root.opts.Format.Render(secret)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"path": s.path, "version": s.version.Number}).Error("error rendering version")
+		return nil, fuse.EIO
+	}
+	s.content = content
+
+	return content, nil
+}
+
+// versions returns the node listing the versions of the secret at the given
+// path, if the backend keeps versions and the secret exists
+func (r *Root) versions(ctx context.Context, p string) (fs.Node, error) {
+	if _, ok := r.backend.(VersionReader); !ok {
+		return nil, fuse.ENOENT
+	}
+
+	metadata, err := r.metadata(ctx, p)
+	if err != nil {
+		logrus.WithError(err).WithField("path", p).Error("error reading metadata")
+		return nil, errno(err)
+	}
+
+	if metadata == nil || len(metadata.Versions) == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	return &Versions{
+		root:     r,
+		path:     p,
+		inode:    r.inodes.get(path.Join(p, versionsDir) + "/"),
+		versions: metadata.Versions,
+	}, nil
+}
+
+// history returns the versions directory of the given prefix, if the backend
+// keeps versions
+func (r *Root) history(p string) fs.Node {
+	if _, ok := r.backend.(VersionReader); !ok {
+		return nil
+	}
+
+	return &History{
+		root:  r,
+		path:  p,
+		inode: r.inodes.get(path.Join(p, versionsDir) + "/"),
+	}
+}
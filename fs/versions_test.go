@@ -0,0 +1,156 @@
+// Copyright © 2016 Asteris, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+func TestHistoryReadDirAll(t *testing.T) {
+	server, kv := newTestKV2(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	root := NewRoot("secret", kv, Options{Layout: LayoutSecret, Format: FormatJSON, Write: WriteNone})
+	node, err := NewDir(root, "secret", 0).Lookup(ctx, versionsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := node.(*History).ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// prefixes have their own versions directory
+	if got, want := names(dirs), []string{"db/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := node.(*History).Lookup(ctx, "missing"); err != fuse.ENOENT {
+		t.Errorf("looking up a missing secret: got %v, want ENOENT", err)
+	}
+}
+
+func TestHistoryMemory(t *testing.T) {
+	root, _ := newTestRoot(t, Options{}, dirSecrets)
+
+	// the memory backend keeps no versions, so there is no versions directory
+	if _, err := NewDir(root, "secret", 0).Lookup(context.Background(), versionsDir); err != fuse.ENOENT {
+		t.Errorf("got %v, want ENOENT", err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	server, kv := newTestKV2(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	root := NewRoot("secret", kv, Options{Layout: LayoutSecret, Format: FormatJSON, Write: WriteNone})
+	node, err := root.versions(ctx, "secret/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := node.(*Versions)
+
+	dirs, err := versions.ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(dirs), []string{"1", "2", "3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		content string
+	}{
+		{"1", 0444, `{"password":"one"}`},
+		{"2", 0400, ""},
+		{"3", 0000, ""},
+		{"4", 0444, `{"password":"four"}`},
+	}
+
+	for _, tt := range tests {
+		node, err := versions.Lookup(ctx, tt.name)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		version := node.(*SecretVersion)
+
+		var attr fuse.Attr
+		if err := version.Attr(ctx, &attr); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if attr.Mode != tt.mode {
+			t.Errorf("%s: got mode %s, want %s", tt.name, attr.Mode, tt.mode)
+		}
+
+		content, err := version.ReadAll(ctx)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if string(content) != tt.content {
+			t.Errorf("%s: got %q, want %q", tt.name, content, tt.content)
+		}
+		if attr.Size != uint64(len(tt.content)) {
+			t.Errorf("%s: got size %d, want %d", tt.name, attr.Size, len(tt.content))
+		}
+	}
+
+	for _, name := range []string{"0", "5", "x"} {
+		if _, err := versions.Lookup(ctx, name); err != fuse.ENOENT {
+			t.Errorf("%s: got %v, want ENOENT", name, err)
+		}
+	}
+
+	if _, err := root.versions(ctx, "secret/missing"); err != fuse.ENOENT {
+		t.Errorf("missing secret: got %v, want ENOENT", err)
+	}
+}
+
+func TestFieldsVersions(t *testing.T) {
+	server, kv := newTestKV2(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	root := NewRoot("secret", kv, Options{Layout: LayoutFields, Format: FormatJSON, Write: WriteNone})
+	node, err := NewDir(root, "secret/team", 0).Lookup(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err = node.(*Fields).Lookup(ctx, versionsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := node.(*Versions).ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(dirs), []string{"1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}